@@ -0,0 +1,339 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	sdklogging "github.com/openshift-online/ocm-sdk-go/logging"
+
+	"github.com/openshift-online/ocm-service-common/pkg/logging"
+)
+
+// TokenSource returns the token sent in the Authorization header of the requests.
+type TokenSource func(ctx context.Context) (string, error)
+
+// HTTPClientBuilder contains the data and logic needed to create HTTP clients whose transport
+// chains, from the outermost to the innermost:
+//
+//   - the injection of the Authorization header,
+//   - the retries, with backoff honoring the Retry-After header,
+//   - the metrics of AddMetricsMiddleware, one observation per attempt,
+//   - the logging of logging.TransportWrapper, one message per attempt,
+//   - the base transport, with the timeouts, the proxy and the TLS configuration.
+//
+// Every layer is optional, only the configured ones are added.
+type HTTPClientBuilder struct {
+	tokenSource           TokenSource
+	retries               int
+	retryDelay            time.Duration
+	maxRetryDelay         time.Duration
+	service               ServiceClient
+	logger                sdklogging.Logger
+	loggingWrapper        *logging.TransportWrapper
+	timeout               time.Duration
+	responseHeaderTimeout time.Duration
+	proxy                 string
+	trustedCAs            []string
+	certFile              string
+	keyFile               string
+	insecure              bool
+	transport             http.RoundTripper
+}
+
+// HTTPClient contains the transport chain created by the builder. It is an http.RoundTripper
+// itself.
+type HTTPClient struct {
+	client  *http.Client
+	wrapper func(http.RoundTripper) http.RoundTripper
+}
+
+// NewHTTPClientBuilder creates a builder that can then be used to configure and create an HTTP
+// client.
+func NewHTTPClientBuilder() *HTTPClientBuilder {
+	return &HTTPClientBuilder{
+		retryDelay:    defaultRetryDelay,
+		maxRetryDelay: defaultMaxRetryDelay,
+	}
+}
+
+// Token sets the token sent as `Authorization: Bearer <token>` with every request.
+func (b *HTTPClientBuilder) Token(value string) *HTTPClientBuilder {
+	return b.TokenSource(func(ctx context.Context) (string, error) {
+		return value, nil
+	})
+}
+
+// TokenSource sets the function called for every request to get the token sent as
+// `Authorization: Bearer <token>`, for tokens that expire. The request fails when it fails.
+func (b *HTTPClientBuilder) TokenSource(value TokenSource) *HTTPClientBuilder {
+	b.tokenSource = value
+	return b
+}
+
+// Retries sets how many times the requests that fail with a connection error, a 429 or a 5xx status
+// code are sent again, see RetryTransport. The default is 0, no retries.
+func (b *HTTPClientBuilder) Retries(value int) *HTTPClientBuilder {
+	b.retries = value
+	return b
+}
+
+// RetryDelay sets the delay before the first retry, doubled for each of the following ones. The
+// default is half a second.
+func (b *HTTPClientBuilder) RetryDelay(value time.Duration) *HTTPClientBuilder {
+	b.retryDelay = value
+	return b
+}
+
+// MaxRetryDelay sets the maximum delay between retries. The response is returned without retrying
+// when its Retry-After header asks to wait longer. The default is 30 seconds.
+func (b *HTTPClientBuilder) MaxRetryDelay(value time.Duration) *HTTPClientBuilder {
+	b.maxRetryDelay = value
+	return b
+}
+
+// Metrics sets the service client whose name and router label the `api_outbound` metrics. No
+// metrics are collected when it isn't set. The metrics need to be registered with
+// RegisterClientMetrics.
+func (b *HTTPClientBuilder) Metrics(value ServiceClient) *HTTPClientBuilder {
+	b.service = value
+	return b
+}
+
+// Logger sets the logger that the requests and responses are written to, with the default
+// configuration of logging.TransportWrapper. Nothing is logged when neither it nor the logging
+// wrapper is set.
+func (b *HTTPClientBuilder) Logger(value sdklogging.Logger) *HTTPClientBuilder {
+	b.logger = value
+	return b
+}
+
+// LoggingWrapper sets the logging transport wrapper, instead of the default one for the logger.
+func (b *HTTPClientBuilder) LoggingWrapper(value *logging.TransportWrapper) *HTTPClientBuilder {
+	b.loggingWrapper = value
+	return b
+}
+
+// Timeout sets the maximum duration of the requests, retries and reading the response body
+// included. The default is no timeout. It doesn't apply to the transport wrapper.
+func (b *HTTPClientBuilder) Timeout(value time.Duration) *HTTPClientBuilder {
+	b.timeout = value
+	return b
+}
+
+// ResponseHeaderTimeout sets the maximum duration waiting for the response headers of each
+// attempt. The default is no timeout. It doesn't apply to the transport wrapper.
+func (b *HTTPClientBuilder) ResponseHeaderTimeout(value time.Duration) *HTTPClientBuilder {
+	b.responseHeaderTimeout = value
+	return b
+}
+
+// Proxy sets the URL of the proxy the requests are sent through. By default the proxy is the one
+// of the HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables. It doesn't apply to the
+// transport wrapper.
+func (b *HTTPClientBuilder) Proxy(value string) *HTTPClientBuilder {
+	b.proxy = value
+	return b
+}
+
+// TrustedCAs adds files containing the PEM encoded certificates of the authorities trusted to
+// sign the certificates of the servers, instead of the ones of the system. It doesn't apply to
+// the transport wrapper.
+func (b *HTTPClientBuilder) TrustedCAs(values ...string) *HTTPClientBuilder {
+	b.trustedCAs = append(b.trustedCAs, values...)
+	return b
+}
+
+// ClientCertificate sets the files containing the PEM encoded certificate and key presented to
+// the servers, for mutual TLS. It doesn't apply to the transport wrapper.
+func (b *HTTPClientBuilder) ClientCertificate(certFile, keyFile string) *HTTPClientBuilder {
+	b.certFile = certFile
+	b.keyFile = keyFile
+	return b
+}
+
+// Insecure disables the verification of the certificates of the servers. It is only meant for
+// tests. It doesn't apply to the transport wrapper.
+func (b *HTTPClientBuilder) Insecure(value bool) *HTTPClientBuilder {
+	b.insecure = value
+	return b
+}
+
+// Transport sets the base transport, instead of a copy of http.DefaultTransport. The timeouts,
+// the proxy and the TLS configuration can't be set together with it.
+func (b *HTTPClientBuilder) Transport(value http.RoundTripper) *HTTPClientBuilder {
+	b.transport = value
+	return b
+}
+
+// Build uses the data stored in the builder to create a new client.
+func (b *HTTPClientBuilder) Build(ctx context.Context) (result *HTTPClient, err error) {
+	// Check parameters:
+	if b.retries < 0 {
+		err = fmt.Errorf("retries should be zero or positive, but it is %d", b.retries)
+		return
+	}
+	if b.retryDelay <= 0 || b.maxRetryDelay < b.retryDelay {
+		err = fmt.Errorf("retry delay %s should be positive and at most the maximum retry delay %s",
+			b.retryDelay, b.maxRetryDelay)
+		return
+	}
+
+	// Create the logging wrapper:
+	loggingWrapper := b.loggingWrapper
+	if loggingWrapper == nil && b.logger != nil {
+		loggingWrapper, err = logging.NewTransportWrapper().
+			Logger(b.logger).
+			Build(ctx)
+		if err != nil {
+			return
+		}
+	}
+
+	// Create the base transport:
+	base := b.transport
+	if base == nil {
+		base, err = b.createTransport()
+		if err != nil {
+			return
+		}
+	} else if b.responseHeaderTimeout != 0 || b.proxy != "" || len(b.trustedCAs) > 0 || b.certFile != "" ||
+		b.insecure {
+		err = fmt.Errorf("timeouts, proxy and TLS can't be set together with the base transport")
+		return
+	}
+
+	// The wrapper adds the layers from the innermost to the outermost:
+	tokenSource := b.tokenSource
+	service := b.service
+	retries := b.retries
+	retryDelay := b.retryDelay
+	maxRetryDelay := b.maxRetryDelay
+	wrapper := func(next http.RoundTripper) http.RoundTripper {
+		if loggingWrapper != nil {
+			next = loggingWrapper.Wrap(next)
+		}
+		if service != nil {
+			next = AddMetricsMiddlewareByTransport(service, next)
+		}
+		if retries > 0 {
+			next = &RetryTransport{
+				Wrapped:  next,
+				Retries:  retries,
+				Delay:    retryDelay,
+				MaxDelay: maxRetryDelay,
+			}
+		}
+		if tokenSource != nil {
+			next = &authTransport{
+				tokenSource: tokenSource,
+				next:        next,
+			}
+		}
+		return next
+	}
+
+	// Create and populate the object:
+	result = &HTTPClient{
+		client: &http.Client{
+			Transport: wrapper(base),
+			Timeout:   b.timeout,
+		},
+		wrapper: wrapper,
+	}
+
+	return
+}
+
+// createTransport creates a copy of the default transport with the timeouts, the proxy and the TLS
+// configuration.
+func (b *HTTPClientBuilder) createTransport() (result *http.Transport, err error) {
+	result = http.DefaultTransport.(*http.Transport).Clone()
+	result.ResponseHeaderTimeout = b.responseHeaderTimeout
+	if b.proxy != "" {
+		var proxy *url.URL
+		proxy, err = url.Parse(b.proxy)
+		if err != nil {
+			err = fmt.Errorf("can't parse proxy URL '%s': %w", b.proxy, err)
+			return
+		}
+		result.Proxy = http.ProxyURL(proxy)
+	}
+	if len(b.trustedCAs) == 0 && b.certFile == "" && !b.insecure {
+		return
+	}
+	config := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// #nosec G402 -- only when explicitly requested
+		InsecureSkipVerify: b.insecure,
+	}
+	if len(b.trustedCAs) > 0 {
+		config.RootCAs = x509.NewCertPool()
+		for _, file := range b.trustedCAs {
+			var data []byte
+			data, err = os.ReadFile(file)
+			if err != nil {
+				err = fmt.Errorf("can't read trusted CAs file '%s': %w", file, err)
+				return
+			}
+			if !config.RootCAs.AppendCertsFromPEM(data) {
+				err = fmt.Errorf("trusted CAs file '%s' doesn't contain any PEM encoded certificate", file)
+				return
+			}
+		}
+	}
+	if b.certFile != "" || b.keyFile != "" {
+		var certificate tls.Certificate
+		certificate, err = tls.LoadX509KeyPair(b.certFile, b.keyFile)
+		if err != nil {
+			err = fmt.Errorf("can't load client certificate '%s' and key '%s': %w", b.certFile, b.keyFile, err)
+			return
+		}
+		config.Certificates = []tls.Certificate{certificate}
+	}
+	result.TLSClientConfig = config
+	return
+}
+
+// Client returns the HTTP client using the transport chain.
+func (c *HTTPClient) Client() *http.Client {
+	return c.client
+}
+
+// Wrap adds the authentication, retries, metrics and logging layers to another transport. It can
+// be given to the TransportWrapper method of the connection builder of the OCM SDK:
+//
+//	connection, err := sdk.NewConnectionBuilder().
+//		TransportWrapper(httpClient.Wrap).
+//		Build()
+func (c *HTTPClient) Wrap(next http.RoundTripper) http.RoundTripper {
+	return c.wrapper(next)
+}
+
+// RoundTrip is the implementation of the http.RoundTripper interface.
+func (c *HTTPClient) RoundTrip(request *http.Request) (*http.Response, error) {
+	return c.client.Transport.RoundTrip(request)
+}
+
+// authTransport is a round tripper that sets the Authorization header of the requests.
+type authTransport struct {
+	tokenSource TokenSource
+	next        http.RoundTripper
+}
+
+// RoundTrip is the implementation of the http.RoundTripper interface.
+func (t *authTransport) RoundTrip(request *http.Request) (*http.Response, error) {
+	token, err := t.tokenSource(request.Context())
+	if err != nil {
+		return nil, fmt.Errorf("can't get authorization token: %w", err)
+	}
+	// The round tripper contract forbids modifying the request:
+	request = request.Clone(request.Context())
+	request.Header.Set("Authorization", "Bearer "+token)
+	return t.next.RoundTrip(request)
+}
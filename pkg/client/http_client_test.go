@@ -0,0 +1,243 @@
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/gorilla/mux"
+	sdklogging "github.com/openshift-online/ocm-sdk-go/logging"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo/v2" // nolint
+	. "github.com/onsi/gomega"    // nolint
+)
+
+var _ = Describe("HTTP client builder", func() {
+	var ctx context.Context
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		ResetClientMetrics()
+	})
+
+	It("Chains the authentication, retries, metrics and logging", func() {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			Expect(r.Header.Get("Authorization")).To(Equal("Bearer my-token"))
+			body, err := io.ReadAll(r.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(string(body)).To(Equal(`{"name":"my"}`))
+			if calls.Add(1) < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			_, _ = w.Write([]byte("ok"))
+		}))
+		defer server.Close()
+		buffer := &bytes.Buffer{}
+		logger, err := sdklogging.NewStdLoggerBuilder().
+			Streams(buffer, buffer).
+			Debug(true).
+			Build()
+		Expect(err).ToNot(HaveOccurred())
+
+		httpClient, err := NewHTTPClientBuilder().
+			Token("my-token").
+			Retries(3).
+			RetryDelay(time.Millisecond).
+			Metrics(&testServiceClient{name: "my-service"}).
+			Logger(logger).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		request, err := http.NewRequest(http.MethodPut, server.URL+"/api/things", strings.NewReader(`{"name":"my"}`))
+		Expect(err).ToNot(HaveOccurred())
+		response, err := httpClient.Client().Do(request)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := io.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(string(body)).To(Equal("ok"))
+		Expect(calls.Load()).To(BeNumerically("==", 3))
+
+		// Every attempt is measured and logged:
+		Expect(testutil.ToFloat64(requestCountMetric.WithLabelValues("my-service", "1", "503", "PUT", "/-"))).
+			To(BeNumerically("==", 1))
+		Expect(testutil.ToFloat64(requestCountMetric.WithLabelValues("my-service", "2", "503", "PUT", "/-"))).
+			To(BeNumerically("==", 1))
+		Expect(testutil.ToFloat64(requestCountMetric.WithLabelValues("my-service", "3", "200", "PUT", "/-"))).
+			To(BeNumerically("==", 1))
+		Expect(strings.Count(buffer.String(), "Received 503 response")).To(Equal(2))
+		Expect(strings.Count(buffer.String(), "Received 200 response")).To(Equal(1))
+		Expect(buffer.String()).ToNot(ContainSubstring("my-token"))
+	})
+
+	It("Doesn't wait longer than the maximum retry delay", func() {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.Header().Set("Retry-After", "3600")
+			w.WriteHeader(http.StatusTooManyRequests)
+		}))
+		defer server.Close()
+
+		httpClient, err := NewHTTPClientBuilder().
+			Retries(3).
+			RetryDelay(time.Millisecond).
+			MaxRetryDelay(time.Second).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := httpClient.Client().Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(response.StatusCode).To(Equal(http.StatusTooManyRequests))
+		Expect(calls.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("Doesn't retry the requests whose body can't be read again", func() {
+		var calls atomic.Int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			calls.Add(1)
+			w.WriteHeader(http.StatusBadGateway)
+		}))
+		defer server.Close()
+
+		httpClient, err := NewHTTPClientBuilder().
+			Retries(3).
+			RetryDelay(time.Millisecond).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		request, err := http.NewRequest(http.MethodPut, server.URL, io.NopCloser(strings.NewReader("data")))
+		Expect(err).ToNot(HaveOccurred())
+		response, err := httpClient.Client().Do(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(response.StatusCode).To(Equal(http.StatusBadGateway))
+		Expect(calls.Load()).To(BeNumerically("==", 1))
+	})
+
+	It("Wraps other transports", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.Header.Get("Authorization")))
+		}))
+		defer server.Close()
+
+		httpClient, err := NewHTTPClientBuilder().
+			TokenSource(func(ctx context.Context) (string, error) {
+				return "fresh-token", nil
+			}).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		client := &http.Client{Transport: httpClient.Wrap(http.DefaultTransport)}
+		response, err := client.Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := io.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(string(body)).To(Equal("Bearer fresh-token"))
+	})
+
+	It("Sends the requests through the proxy", func() {
+		var proxied atomic.Value
+		proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			proxied.Store(r.URL.String())
+		}))
+		defer proxy.Close()
+
+		httpClient, err := NewHTTPClientBuilder().
+			Proxy(proxy.URL).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := httpClient.Client().Get("http://api.example.com/api/things")
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(proxied.Load()).To(Equal("http://api.example.com/api/things"))
+	})
+
+	It("Uses the trusted CAs and the client certificate", func() {
+		server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte(r.TLS.PeerCertificates[0].Subject.Organization[0]))
+		}))
+		server.TLS = &tls.Config{ClientAuth: tls.RequireAnyClientCert}
+		server.Config.ErrorLog = log.New(io.Discard, "", 0)
+		server.StartTLS()
+		defer server.Close()
+
+		// The test server certificate is used both to trust the server and as client certificate:
+		dir := GinkgoT().TempDir()
+		certFile := filepath.Join(dir, "tls.crt")
+		keyFile := filepath.Join(dir, "tls.key")
+		certificate := server.TLS.Certificates[0]
+		key, err := x509.MarshalPKCS8PrivateKey(certificate.PrivateKey)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{
+			Type:  "CERTIFICATE",
+			Bytes: certificate.Certificate[0],
+		}), 0600)).To(Succeed())
+		Expect(os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{
+			Type:  "PRIVATE KEY",
+			Bytes: key,
+		}), 0600)).To(Succeed())
+
+		// Without the client certificate the server rejects the connection:
+		httpClient, err := NewHTTPClientBuilder().
+			TrustedCAs(certFile).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = httpClient.Client().Get(server.URL)
+		Expect(err).To(HaveOccurred())
+
+		httpClient, err = NewHTTPClientBuilder().
+			TrustedCAs(certFile).
+			ClientCertificate(certFile, keyFile).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		response, err := httpClient.Client().Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := io.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(string(body)).To(Equal("Acme Co"))
+	})
+
+	It("Rejects invalid configurations", func() {
+		_, err := NewHTTPClientBuilder().Retries(-1).Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("retries")))
+		_, err = NewHTTPClientBuilder().RetryDelay(time.Minute).MaxRetryDelay(time.Second).Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("retry delay")))
+		_, err = NewHTTPClientBuilder().TrustedCAs("/does/not/exist").Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("can't read trusted CAs")))
+		_, err = NewHTTPClientBuilder().Transport(http.DefaultTransport).Proxy("http://proxy").Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("can't be set together")))
+	})
+})
+
+// testServiceClient is a service client without routes, its paths are reduced to `/-`.
+type testServiceClient struct {
+	name string
+}
+
+func (c *testServiceClient) GetServiceName() string {
+	return c.name
+}
+
+func (c *testServiceClient) GetRouter() *mux.Router {
+	return nil
+}
@@ -0,0 +1,225 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"github.com/openshift-online/ocm-sdk-go/authentication"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// metrics name and labels, the ones queried by the dashboards of pkg/grafana
+const (
+	InboundMetricsSubsystem           = "api_inbound"
+	InboundMetricsServiceAccountLabel = "service_account"
+	InboundMetricsCodeLabel           = "code"
+	InboundMetricsMethodLabel         = "method"
+	InboundMetricsPathLabel           = "path"
+
+	claimPreferredUsername = "preferred_username"
+	claimUsername          = "username"
+	claimClientId          = "client_id"
+	claimClientIdLegacy    = "clientId"
+)
+
+// labels added to metrics:
+var inboundMetricsLabels = []string{
+	InboundMetricsServiceAccountLabel,
+	InboundMetricsCodeLabel,
+	InboundMetricsMethodLabel,
+	InboundMetricsPathLabel,
+}
+
+// count metric
+var inboundRequestCountMetric = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Subsystem: InboundMetricsSubsystem,
+		Name:      "request_count",
+		Help:      "Number of requests served.",
+	},
+	inboundMetricsLabels,
+)
+
+// duration metric
+var inboundRequestDurationMetric = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Subsystem: InboundMetricsSubsystem,
+		Name:      "request_duration",
+		Help:      "Request duration in seconds.",
+		Buckets: []float64{
+			0.1,
+			1.0,
+			2.0,
+			5.0,
+			10.0,
+			30.0,
+		},
+	},
+	inboundMetricsLabels,
+)
+
+// RegisterInboundMetrics registers the metrics of the metrics middleware with the Prometheus library.
+func RegisterInboundMetrics(ctx context.Context) error {
+	// Register the count metric:
+	err := prometheus.Register(inboundRequestCountMetric)
+	if err != nil {
+		registered, ok := err.(prometheus.AlreadyRegisteredError)
+		if ok {
+			inboundRequestCountMetric = registered.ExistingCollector.(*prometheus.CounterVec)
+		} else {
+			return err
+		}
+	}
+
+	// Register the duration metric:
+	err = prometheus.Register(inboundRequestDurationMetric)
+	if err != nil {
+		registered, ok := err.(prometheus.AlreadyRegisteredError)
+		if ok {
+			inboundRequestDurationMetric = registered.ExistingCollector.(*prometheus.HistogramVec)
+		} else {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func ResetInboundMetrics() {
+	inboundRequestCountMetric.Reset()
+	inboundRequestDurationMetric.Reset()
+}
+
+// NewInboundMetricsMiddleware creates an HTTP server middleware that counts and times the requests
+// in the `api_inbound_request_count` and `api_inbound_request_duration` metrics, labelled with:
+//
+//   - service_account: the user name, or the client id, of the token of the request, empty without
+//     token,
+//   - path: the gorilla/mux template of the route, with `-` in place of the variables, `/-` when no
+//     route matched, like the paths of the `api_outbound` metrics,
+//   - code: the status code of the response, 101 when the handler hijacks the connection, 500 when
+//     the handler panics, the panic is then propagated,
+//   - method: the method of the request.
+//
+// Add it to the router with `router.Use`, so that the route is known, inside the authentication
+// handler, so that the token is in the context.
+func NewInboundMetricsMiddleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			recorder := &statusRecorder{ResponseWriter: w}
+			completed := false
+			defer func() {
+				code := recorder.status
+				switch {
+				case !completed:
+					// the handler panicked, the server answers 500 or closes the connection
+					code = http.StatusInternalServerError
+				case code == 0:
+					code = http.StatusOK
+				}
+				labels := prometheus.Labels{
+					InboundMetricsServiceAccountLabel: serviceAccountFromContext(r.Context()),
+					InboundMetricsCodeLabel:           strconv.Itoa(code),
+					InboundMetricsMethodLabel:         r.Method,
+					InboundMetricsPathLabel:           inboundPath(r),
+				}
+				inboundRequestCountMetric.With(labels).Inc()
+				inboundRequestDurationMetric.With(labels).Observe(time.Since(start).Seconds())
+			}()
+			next.ServeHTTP(recorder, r)
+			completed = true
+		})
+	}
+}
+
+// inboundPath returns the template of the route of the request, with the variables replaced like
+// reducePath does.
+func inboundPath(r *http.Request) string {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "/" + PathVarSub
+	}
+	template, err := route.GetPathTemplate()
+	if err != nil {
+		return "/" + PathVarSub
+	}
+	return metricsPathVarRE.ReplaceAllString(template, PathVarSub)
+}
+
+// serviceAccountFromContext returns the user name of the token of the context, or its client id
+// for service accounts.
+func serviceAccountFromContext(ctx context.Context) string {
+	token, err := authentication.TokenFromContext(ctx)
+	if err != nil || token == nil {
+		return ""
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return ""
+	}
+	for _, claim := range []string{claimPreferredUsername, claimUsername, claimClientId, claimClientIdLegacy} {
+		if value, ok := claims[claim].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// statusRecorder captures the status code written by the handler. It forwards Flush and Hijack, so
+// that the streaming and websocket handlers keep working behind the middleware.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Flush sends the buffered data to the client, when the wrapped writer supports it.
+func (s *statusRecorder) Flush() {
+	flusher, ok := s.ResponseWriter.(http.Flusher)
+	if !ok {
+		return
+	}
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	flusher.Flush()
+}
+
+// Hijack lets the handler take over the connection, the response is then counted as switching
+// protocols unless the handler wrote a status code before.
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, http.ErrNotSupported
+	}
+	conn, buffer, err := hijacker.Hijack()
+	if err == nil && s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return conn, buffer, err
+}
+
+// Unwrap allows http.ResponseController to reach the other features of the wrapped writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
@@ -0,0 +1,122 @@
+package client
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+
+	jwt "github.com/golang-jwt/jwt/v4"
+	"github.com/gorilla/mux"
+	"github.com/openshift-online/ocm-sdk-go/authentication"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+
+	. "github.com/onsi/ginkgo/v2" // nolint
+	. "github.com/onsi/gomega"    // nolint
+)
+
+var _ = Describe("Metrics middleware", func() {
+	var router *mux.Router
+
+	BeforeEach(func() {
+		ResetInboundMetrics()
+		router = mux.NewRouter()
+		router.Use(NewInboundMetricsMiddleware())
+		router.HandleFunc("/api/v1/clusters/{id}", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusAccepted)
+		}).Methods(http.MethodPatch)
+		router.HandleFunc("/api/v1/clusters", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = w.Write([]byte("[]"))
+		}).Methods(http.MethodGet)
+	})
+
+	serve := func(ctx context.Context, handler http.Handler, method, path string) {
+		request := httptest.NewRequest(method, path, nil).WithContext(ctx)
+		handler.ServeHTTP(httptest.NewRecorder(), request)
+	}
+
+	count := func(serviceAccount, code, method, path string) float64 {
+		return testutil.ToFloat64(inboundRequestCountMetric.WithLabelValues(serviceAccount, code, method, path))
+	}
+
+	It("Labels the requests with the user of the token and the route template", func() {
+		ctx := tokenContext(jwt.MapClaims{"preferred_username": "jdoe", "client_id": "cloud-services"})
+		serve(ctx, router, http.MethodPatch, "/api/v1/clusters/123")
+		serve(ctx, router, http.MethodPatch, "/api/v1/clusters/456")
+		serve(ctx, router, http.MethodGet, "/api/v1/clusters")
+
+		Expect(count("jdoe", "202", "PATCH", "/api/v1/clusters/-")).To(BeNumerically("==", 2))
+		Expect(count("jdoe", "200", "GET", "/api/v1/clusters")).To(BeNumerically("==", 1))
+		Expect(testutil.CollectAndCount(inboundRequestDurationMetric)).To(Equal(2))
+	})
+
+	It("Labels the requests of service accounts with their client id", func() {
+		serve(tokenContext(jwt.MapClaims{"clientId": "my-sa"}), router, http.MethodGet, "/api/v1/clusters")
+		serve(context.Background(), router, http.MethodGet, "/api/v1/clusters")
+
+		Expect(count("my-sa", "200", "GET", "/api/v1/clusters")).To(BeNumerically("==", 1))
+		Expect(count("", "200", "GET", "/api/v1/clusters")).To(BeNumerically("==", 1))
+	})
+
+	It("Uses `/-` as path when no route matched", func() {
+		handler := NewInboundMetricsMiddleware()(http.NotFoundHandler())
+		serve(context.Background(), handler, http.MethodGet, "/unknown")
+
+		Expect(count("", "404", "GET", "/-")).To(BeNumerically("==", 1))
+	})
+
+	It("Uses 500 as code when the handler panics", func() {
+		handler := NewInboundMetricsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("boom")
+		}))
+		Expect(func() {
+			serve(context.Background(), handler, http.MethodGet, "/api")
+		}).To(PanicWith("boom"))
+
+		Expect(count("", "500", "GET", "/-")).To(BeNumerically("==", 1))
+	})
+
+	It("Forwards the flushes of the handler", func() {
+		handler := NewInboundMetricsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			flusher, ok := w.(http.Flusher)
+			Expect(ok).To(BeTrue())
+			flusher.Flush()
+		}))
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/events", nil))
+
+		Expect(recorder.Flushed).To(BeTrue())
+		Expect(count("", "200", "GET", "/-")).To(BeNumerically("==", 1))
+	})
+
+	It("Forwards the hijacks of the handler", func() {
+		handler := NewInboundMetricsMiddleware()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			hijacker, ok := w.(http.Hijacker)
+			Expect(ok).To(BeTrue())
+			_, _, err := hijacker.Hijack()
+			Expect(err).ToNot(HaveOccurred())
+		}))
+		writer := &hijackableWriter{ResponseRecorder: httptest.NewRecorder()}
+		handler.ServeHTTP(writer, httptest.NewRequest(http.MethodGet, "/socket", nil))
+
+		Expect(writer.hijacked).To(BeTrue())
+		Expect(count("", "101", "GET", "/-")).To(BeNumerically("==", 1))
+	})
+})
+
+// hijackableWriter is a response recorder whose connection can be hijacked.
+type hijackableWriter struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (w *hijackableWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	w.hijacked = true
+	return nil, nil, nil
+}
+
+func tokenContext(claims jwt.MapClaims) context.Context {
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return authentication.ContextWithToken(context.Background(), token)
+}
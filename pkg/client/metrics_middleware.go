@@ -17,6 +17,7 @@ import (
 const (
 	MetricsSubsystem       = "api_outbound"
 	MetricsAPIServiceLabel = "apiservice"
+	MetricsAttemptLabel    = "attempt"
 	MetricsCodeLabel       = "code"
 	MetricsMethodLabel     = "method"
 	MetricsPathLabel       = "path"
@@ -80,7 +81,8 @@ func (m *metricsRoundTripperWrapper) RoundTrip(request *http.Request) (*http.Res
 	if response != nil {
 		code = response.StatusCode
 	}
-	updateMetrics(serviceName, request.Method, path, strconv.Itoa(code), elapsed.Seconds())
+	attempt := strconv.Itoa(attemptFromContext(request.Context()))
+	updateMetrics(serviceName, attempt, request.Method, path, strconv.Itoa(code), elapsed.Seconds())
 
 	return response, err
 }
@@ -91,6 +93,7 @@ var metricsPathVarRE = regexp.MustCompile(`{[^}]*}`)
 // labels added to metrics:
 var metricsLabels = []string{
 	MetricsAPIServiceLabel,
+	MetricsAttemptLabel,
 	MetricsCodeLabel,
 	MetricsMethodLabel,
 	MetricsPathLabel,
@@ -182,10 +185,12 @@ func reducePath(router *mux.Router, request *http.Request) (path, serviceName st
 	return path, serviceName
 }
 
-func updateMetrics(apiService string, method string, path string, code string, durationInSecs float64) {
+func updateMetrics(apiService string, attempt string, method string, path string, code string,
+	durationInSecs float64) {
 
 	labels := map[string]string{
 		MetricsAPIServiceLabel: apiService,
+		MetricsAttemptLabel:    attempt,
 		MetricsMethodLabel:     method,
 		MetricsPathLabel:       path,
 		MetricsCodeLabel:       code,
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	// DefaultIdempotencyKeyHeader is the header that makes POST and PATCH requests retriable.
+	DefaultIdempotencyKeyHeader = "Idempotency-Key"
+
+	defaultRetryDelay    = 500 * time.Millisecond
+	defaultMaxRetryDelay = 30 * time.Second
+
+	// maxDrainedBodyLength is the number of bytes of a response body read before retrying, so that
+	// the connection can be reused.
+	maxDrainedBodyLength = 4096
+)
+
+// idempotentMethods are the methods whose requests can be sent again without side effects.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:     true,
+	http.MethodHead:    true,
+	http.MethodOptions: true,
+	http.MethodTrace:   true,
+	http.MethodPut:     true,
+	http.MethodDelete:  true,
+}
+
+// attemptContextKey is the key of the attempt number in the contexts of the requests.
+type attemptContextKey struct{}
+
+// RetryTransport is a round tripper that sends again the requests that fail with a connection error,
+// a 429 or a 5xx status code, waiting longer and longer between attempts, or what the Retry-After
+// header of the response says. Only the requests with an idempotent method, or with an idempotency
+// key, whose body can be read again with GetBody are retried. The number of the attempt labels the
+// `api_outbound` metrics of the transports it wraps.
+type RetryTransport struct {
+	Wrapped http.RoundTripper
+	// Retries is the maximum number of times a request is sent again.
+	Retries int
+	// Delay is the delay before the first retry, doubled for each of the following ones. The default
+	// is half a second.
+	Delay time.Duration
+	// MaxDelay is the maximum delay between retries. The response is returned without retrying when
+	// its Retry-After header asks to wait longer. The default is 30 seconds.
+	MaxDelay time.Duration
+	// IdempotencyKeyHeader is the header whose presence makes POST and PATCH requests retriable,
+	// `Idempotency-Key` by default.
+	IdempotencyKeyHeader string
+}
+
+// RoundTrip is the implementation of the http.RoundTripper interface.
+func (t *RetryTransport) RoundTrip(request *http.Request) (response *http.Response, err error) {
+	ctx := request.Context()
+	canRetry := t.canRetry(request)
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			request, err = rewindRequest(request)
+			if err != nil {
+				return
+			}
+		}
+		response, err = t.Wrapped.RoundTrip(request.WithContext(context.WithValue(ctx, attemptContextKey{}, attempt)))
+		if !canRetry || attempt > t.Retries || !retriable(ctx, response, err) {
+			return
+		}
+		wait := t.backoff(attempt)
+		if response != nil {
+			if after, ok := retryAfter(response); ok {
+				if after > t.maxDelay() {
+					// waiting that long would look like the client hangs
+					return
+				}
+				wait = after
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok && time.Now().Add(wait).After(deadline) {
+			// the next attempt would fail anyhow, the last outcome is more useful
+			return
+		}
+		if response != nil {
+			drainBody(response)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (t *RetryTransport) maxDelay() time.Duration {
+	if t.MaxDelay > 0 {
+		return t.MaxDelay
+	}
+	return defaultMaxRetryDelay
+}
+
+// backoff returns the delay before the next attempt, doubled after each attempt up to the maximum
+// delay, with a random jitter of up to a fifth so that clients don't retry all at the same time.
+func (t *RetryTransport) backoff(attempt int) time.Duration {
+	delay := t.Delay
+	if delay <= 0 {
+		delay = defaultRetryDelay
+	}
+	maxDelay := t.maxDelay()
+	delay <<= min(attempt-1, 30)
+	if delay <= 0 || delay > maxDelay {
+		delay = maxDelay
+	}
+	return delay - time.Duration(rand.Int64N(int64(delay)/5+1))
+}
+
+// canRetry checks if the request can be sent again: it is idempotent and its body can be read again.
+func (t *RetryTransport) canRetry(request *http.Request) bool {
+	if request.Body != nil && request.Body != http.NoBody && request.GetBody == nil {
+		return false
+	}
+	if idempotentMethods[request.Method] {
+		return true
+	}
+	header := t.IdempotencyKeyHeader
+	if header == "" {
+		header = DefaultIdempotencyKeyHeader
+	}
+	return request.Header.Get(header) != ""
+}
+
+// retriable checks if the outcome of an attempt is worth another one.
+func retriable(ctx context.Context, response *http.Response, err error) bool {
+	if err != nil {
+		return ctx.Err() == nil && !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+	}
+	return response.StatusCode == http.StatusTooManyRequests || response.StatusCode >= 500
+}
+
+// rewindRequest returns a copy of the request with a new body, as the body of the previous attempt
+// has been consumed.
+func rewindRequest(request *http.Request) (*http.Request, error) {
+	if request.GetBody == nil {
+		return request, nil
+	}
+	body, err := request.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	request = request.Clone(request.Context())
+	request.Body = body
+	return request, nil
+}
+
+// retryAfter returns the delay requested by the Retry-After header of the response, either in
+// seconds or as a date.
+func retryAfter(response *http.Response) (time.Duration, bool) {
+	value := response.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(time.Until(date), 0), true
+	}
+	return 0, false
+}
+
+// drainBody reads the beginning of the body of a response that won't be returned, and closes it.
+func drainBody(response *http.Response) {
+	if response.Body == nil {
+		return
+	}
+	_, _ = io.CopyN(io.Discard, response.Body, maxDrainedBodyLength)
+	_ = response.Body.Close()
+}
+
+// attemptFromContext returns the number of the attempt of the request, 1 when it isn't sent by a
+// RetryTransport.
+func attemptFromContext(ctx context.Context) int {
+	if attempt, ok := ctx.Value(attemptContextKey{}).(int); ok {
+		return attempt
+	}
+	return 1
+}
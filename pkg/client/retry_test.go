@@ -0,0 +1,146 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2" // nolint
+	. "github.com/onsi/gomega"    // nolint
+)
+
+var _ = Describe("Retry transport", func() {
+	var (
+		wrapped   *scriptedRoundTripper
+		transport *RetryTransport
+	)
+
+	BeforeEach(func() {
+		wrapped = &scriptedRoundTripper{}
+		transport = &RetryTransport{
+			Wrapped: wrapped,
+			Retries: 3,
+			Delay:   time.Millisecond,
+		}
+	})
+
+	It("Retries the idempotent requests, rewinding their body", func() {
+		wrapped.statuses = []int{http.StatusInternalServerError, http.StatusTooManyRequests, http.StatusOK}
+		request, err := http.NewRequest(http.MethodPut, "http://localhost/api", strings.NewReader("data"))
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(wrapped.bodies).To(Equal([]string{"data", "data", "data"}))
+		Expect(wrapped.attempts).To(Equal([]int{1, 2, 3}))
+	})
+
+	It("Retries the connection errors", func() {
+		wrapped.errs = []error{errors.New("connection refused")}
+		wrapped.statuses = []int{0, http.StatusOK}
+		request, err := http.NewRequest(http.MethodGet, "http://localhost/api", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusOK))
+		Expect(wrapped.attempts).To(Equal([]int{1, 2}))
+	})
+
+	It("Retries POST requests only with an idempotency key", func() {
+		wrapped.statuses = []int{http.StatusServiceUnavailable, http.StatusCreated}
+		request, err := http.NewRequest(http.MethodPost, "http://localhost/api", strings.NewReader("data"))
+		Expect(err).ToNot(HaveOccurred())
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(wrapped.attempts).To(Equal([]int{1}))
+
+		wrapped = &scriptedRoundTripper{statuses: []int{http.StatusServiceUnavailable, http.StatusCreated}}
+		transport.Wrapped = wrapped
+		request, err = http.NewRequest(http.MethodPost, "http://localhost/api", strings.NewReader("data"))
+		Expect(err).ToNot(HaveOccurred())
+		request.Header.Set("Idempotency-Key", "123")
+		response, err = transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusCreated))
+		Expect(wrapped.attempts).To(Equal([]int{1, 2}))
+	})
+
+	It("Doesn't retry the client errors", func() {
+		wrapped.statuses = []int{http.StatusNotFound, http.StatusOK}
+		request, err := http.NewRequest(http.MethodGet, "http://localhost/api", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusNotFound))
+		Expect(wrapped.attempts).To(Equal([]int{1}))
+	})
+
+	It("Stops retrying when the retries are exhausted", func() {
+		wrapped.statuses = []int{502, 502, 502, 502, 502, 200}
+		request, err := http.NewRequest(http.MethodGet, "http://localhost/api", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusBadGateway))
+		Expect(wrapped.attempts).To(Equal([]int{1, 2, 3, 4}))
+	})
+
+	It("Doesn't wait beyond the deadline of the context", func() {
+		wrapped.statuses = []int{http.StatusServiceUnavailable, http.StatusOK}
+		wrapped.retryAfter = "10"
+		transport.MaxDelay = time.Minute
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		defer cancel()
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://localhost/api", nil)
+		Expect(err).ToNot(HaveOccurred())
+
+		start := time.Now()
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.StatusCode).To(Equal(http.StatusServiceUnavailable))
+		Expect(time.Since(start)).To(BeNumerically("<", time.Second))
+		Expect(wrapped.attempts).To(Equal([]int{1}))
+	})
+})
+
+// scriptedRoundTripper is a round tripper that returns the errors, then the responses with the
+// status codes, in order, and records the attempts and the bodies it receives.
+type scriptedRoundTripper struct {
+	errs       []error
+	statuses   []int
+	retryAfter string
+	attempts   []int
+	bodies     []string
+}
+
+// RoundTrip is the implementation of the round tripper interface.
+func (t *scriptedRoundTripper) RoundTrip(request *http.Request) (*http.Response, error) {
+	call := len(t.attempts)
+	t.attempts = append(t.attempts, attemptFromContext(request.Context()))
+	if request.Body != nil {
+		body, err := io.ReadAll(request.Body)
+		Expect(err).ToNot(HaveOccurred())
+		t.bodies = append(t.bodies, string(body))
+	}
+	if call < len(t.errs) && t.errs[call] != nil {
+		return nil, t.errs[call]
+	}
+	header := http.Header{}
+	if t.retryAfter != "" {
+		header.Set("Retry-After", t.retryAfter)
+	}
+	return &http.Response{
+		StatusCode: t.statuses[call],
+		Header:     header,
+		Body:       http.NoBody,
+		Request:    request,
+	}, nil
+}
@@ -79,7 +79,7 @@ func NewClient(ctx context.Context, config *ClientConfiguration) (*Client, error
 			Endpoint:  config.BaseURL,
 			BatchSize: 1,
 			Verbose:   true,
-			Logger:    logger.NewSegmentLogWrapper(),
+			Logger:    logger.NewSegmentLogWrapperWithContext(ctx),
 			RetryAfter: func(attempt int) time.Duration {
 				return time.Duration(attempt * 10)
 			},
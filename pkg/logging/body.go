@@ -0,0 +1,209 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/openshift-online/ocm-service-common/pkg/ocmlogger"
+)
+
+// defaultMaxBodyLength is the number of bytes of the bodies logged when Transport.MaxBodyLength is
+// not set.
+const defaultMaxBodyLength = 10000
+
+// sensitiveHeaders are always redacted when they are logged, whatever the redactor.
+var sensitiveHeaders = map[string]bool{
+	"Authorization":       true,
+	"Proxy-Authorization": true,
+	"Cookie":              true,
+	"Set-Cookie":          true,
+}
+
+func (t *Transport) maxBodyLength() int {
+	if t.MaxBodyLength > 0 {
+		return t.MaxBodyLength
+	}
+	return defaultMaxBodyLength
+}
+
+// peekRequestBody returns the first bytes of the request body, up to the maximum length, and
+// whether there are more. It reads them from a copy of the body when the request has GetBody,
+// otherwise it puts them back in front of the body.
+func (t *Transport) peekRequestBody(request *http.Request) (payload []byte, truncated bool, err error) {
+	limit := int64(t.maxBodyLength())
+	if request.GetBody != nil {
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, false, err
+		}
+		defer body.Close()
+		payload, err = io.ReadAll(io.LimitReader(body, limit+1))
+		if err != nil {
+			return nil, false, err
+		}
+	} else {
+		payload, err = io.ReadAll(io.LimitReader(request.Body, limit+1))
+		if err != nil {
+			return nil, false, err
+		}
+		request.Body = &prefixedBody{
+			Reader: io.MultiReader(bytes.NewReader(payload), request.Body),
+			Closer: request.Body,
+		}
+	}
+	if int64(len(payload)) > limit {
+		return payload[:limit], true, nil
+	}
+	return payload, false, nil
+}
+
+// prefixedBody is a request body whose first bytes were already read.
+type prefixedBody struct {
+	io.Reader
+	io.Closer
+}
+
+// capturingBody keeps the first bytes of a response body while the caller reads it, and calls done
+// once it is read entirely or closed.
+type capturingBody struct {
+	io.ReadCloser
+	limit    int
+	captured bytes.Buffer
+	total    int64
+	once     sync.Once
+	done     func(captured []byte, total int64, complete bool)
+}
+
+func (b *capturingBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	if room := b.limit - b.captured.Len(); room > 0 {
+		b.captured.Write(p[:min(n, room)])
+	}
+	b.total += int64(n)
+	if err == io.EOF {
+		b.finish(true)
+	}
+	return n, err
+}
+
+func (b *capturingBody) Close() error {
+	b.finish(false)
+	return b.ReadCloser.Close()
+}
+
+func (b *capturingBody) finish(complete bool) {
+	b.once.Do(func() {
+		b.done(b.captured.Bytes(), b.total, complete)
+	})
+}
+
+// captureResponseBody replaces the body of the response with one logging the message followed by
+// the first bytes of the body, once the caller has read it or closed it.
+func (t *Transport) captureResponseBody(ctx context.Context, response *http.Response, msg string,
+	redactor *ocmlogger.Redactor) {
+	contentType := response.Header.Get("Content-Type")
+	response.Body = &capturingBody{
+		ReadCloser: response.Body,
+		limit:      t.maxBodyLength(),
+		done: func(captured []byte, total int64, complete bool) {
+			switch {
+			case complete:
+				msg = fmt.Sprintf("%s: %s", msg, t.formatBody(contentType, captured,
+					total > int64(len(captured)), total, redactor))
+			case len(captured) > 0:
+				// closed before the end, its length is unknown
+				msg = fmt.Sprintf("%s: %s", msg, t.formatBody(contentType, captured, true, -1, redactor))
+			}
+			t.Logger.Info(ctx, "%s", msg)
+		},
+	}
+}
+
+// formatBody renders the logged part of a body: redacted, with JSON compacted or indented, and
+// omitted when it isn't text. The total length is negative when unknown.
+func (t *Transport) formatBody(contentType string, payload []byte, truncated bool, total int64,
+	redactor *ocmlogger.Redactor) string {
+	if !truncated {
+		total = int64(len(payload))
+	}
+	if !isText(contentType, payload) {
+		if total >= 0 {
+			return fmt.Sprintf("[%d bytes of %s omitted]", total, contentType)
+		}
+		return fmt.Sprintf("[binary body of %s omitted]", contentType)
+	}
+	redacted := redactor.RedactBody(contentType, payload)
+	if !truncated && json.Valid(redacted) {
+		var formatted bytes.Buffer
+		var err error
+		if t.PrettyJSON {
+			err = json.Indent(&formatted, redacted, "", "  ")
+		} else {
+			err = json.Compact(&formatted, redacted)
+		}
+		if err == nil {
+			redacted = formatted.Bytes()
+		}
+	}
+	switch {
+	case !truncated:
+		return string(redacted)
+	case total >= 0:
+		return fmt.Sprintf("%s... trimmed - payload length (%d) is too long", redacted, total)
+	default:
+		return fmt.Sprintf("%s... trimmed", redacted)
+	}
+}
+
+// isText tells whether a body of the content type can be logged. Without content type, the body
+// is text when it is valid UTF-8.
+func isText(contentType string, payload []byte) bool {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "":
+		// the payload may end in the middle of a rune
+		for i := 0; i < utf8.UTFMax && len(payload) > 0 && !utf8.Valid(payload); i++ {
+			payload = payload[:len(payload)-1]
+		}
+		return utf8.Valid(payload) && !bytes.ContainsRune(payload, 0)
+	case strings.HasPrefix(mediaType, "text/"),
+		strings.HasSuffix(mediaType, "json"),
+		strings.HasSuffix(mediaType, "xml"),
+		strings.HasSuffix(mediaType, "yaml"),
+		mediaType == "application/x-www-form-urlencoded",
+		mediaType == "application/javascript":
+		return true
+	}
+	return false
+}
+
+// formatHeaders renders the LogHeaders present in the header, sensitive values redacted.
+func (t *Transport) formatHeaders(header http.Header, redactor *ocmlogger.Redactor) string {
+	var logged []string
+	for _, name := range t.LogHeaders {
+		name = http.CanonicalHeaderKey(name)
+		values, found := header[name]
+		if !found {
+			continue
+		}
+		value := strings.Join(values, ", ")
+		if sensitiveHeaders[name] {
+			value = ocmlogger.RedactedMask
+		} else {
+			value = fmt.Sprint(redactor.RedactValue(name, value))
+		}
+		logged = append(logged, name+": "+value)
+	}
+	if len(logged) == 0 {
+		return ""
+	}
+	return " {" + strings.Join(logged, ", ") + "}"
+}
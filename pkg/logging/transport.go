@@ -1,13 +1,13 @@
 package logging
 
 import (
-	"context"
 	"fmt"
-	"io"
 	"net/http"
 	"strings"
 
 	"github.com/openshift-online/ocm-sdk-go/logging"
+
+	"github.com/openshift-online/ocm-service-common/pkg/ocmlogger"
 )
 
 const opIDHeader = "X-Operation-ID"
@@ -22,58 +22,70 @@ type Transport struct {
 	// Bodies won't be logged if the path ("/...") starts with ANY of the prefixes exclusions.
 	LogRequestBodyPrefixExclusions  []string
 	LogResponseBodyPrefixExclusions []string
+	// Redactor removes sensitive data from the logged URLs and bodies, the ocmlogger one is used when nil.
+	Redactor *ocmlogger.Redactor
+	// MaxBodyLength is the number of bytes of the bodies logged, 10000 by default. Only that many are
+	// kept in memory, the rest of the response bodies is streamed to the caller.
+	MaxBodyLength int
+	// LogHeaders are the request and response headers logged, none by default. The values of
+	// Authorization, Proxy-Authorization, Cookie, Set-Cookie and of the sensitive keys of the
+	// redactor are redacted.
+	LogHeaders []string
+	// PrettyJSON indents the logged JSON bodies, they are compacted otherwise. Binary bodies are
+	// never logged, only their length.
+	PrettyJSON bool
 }
 
+// RoundTrip logs the request, then the response once its body is read or closed by the caller when
+// the body is logged, otherwise as soon as it is received.
 func (t *Transport) RoundTrip(request *http.Request) (response *http.Response, err error) {
-	msg := fmt.Sprintf("Sending %s %s", request.Method, request.URL.String())
+	ctx := request.Context()
+	redactor := t.redactor()
+	msg := fmt.Sprintf("Sending %s %s", request.Method, redactor.RedactURL(request.URL))
+	msg += t.formatHeaders(request.Header, redactor)
 	shouldLog := t.shouldLog(request.URL.Path, t.LogRequestBodyPrefixes, t.LogRequestBodyPrefixExclusions)
 	if request.Body != nil && shouldLog {
-		payload, err := t.getPayload(request.Context(), request.Body)
+		payload, truncated, err := t.peekRequestBody(request)
 		if err != nil {
+			t.Logger.Error(ctx, "failed to read body")
 			return nil, err
 		}
-		msg = fmt.Sprintf("%s: %s", msg, payload)
-		request.Body = io.NopCloser(strings.NewReader(payload))
+		// a zero length means unknown when there is a body
+		total := request.ContentLength
+		if total <= 0 {
+			total = -1
+		}
+		msg = fmt.Sprintf("%s: %s", msg, t.formatBody(request.Header.Get("Content-Type"), payload, truncated,
+			total, redactor))
 	}
-	t.Logger.Info(request.Context(), "%s", msg)
+	t.Logger.Info(ctx, "%s", msg)
 
 	response, err = t.Wrapped.RoundTrip(request)
 	if err != nil {
 		return
 	}
 
-	msg = fmt.Sprintf("Got back http %d for %s %s", response.StatusCode, request.Method, request.URL.String())
+	msg = fmt.Sprintf("Got back http %d for %s %s", response.StatusCode, request.Method,
+		redactor.RedactURL(request.URL))
 	opID := response.Header.Get(opIDHeader)
 	if opID != "" {
 		msg = fmt.Sprintf("%s [op-id=%s]", msg, opID)
 	}
+	msg += t.formatHeaders(response.Header, redactor)
 	shouldLog = t.shouldLog(request.URL.Path, t.LogResponseBodyPrefixes, t.LogResponseBodyPrefixExclusions)
 	if response.Body != nil && shouldLog {
-		payload, err := t.getPayload(request.Context(), response.Body)
-		if err != nil {
-			return nil, err
-		}
-		msg = t.addPayloadToMessage(msg, &payload)
-		response.Body = io.NopCloser(strings.NewReader(payload))
+		t.captureResponseBody(ctx, response, msg, redactor)
+		return
 	}
-	t.Logger.Info(request.Context(), "%s", msg)
+	t.Logger.Info(ctx, "%s", msg)
 	return
 }
 
-func (t *Transport) addPayloadToMessage(msg string, payload *string) string {
-	const maxPayloadLengthToLog = 10000
-	var payloadToLog *string
-	if len(*payload) > maxPayloadLengthToLog {
-		payloadToLog = t.toPointer(fmt.Sprintf("%s... trimmed - payload length (%d) is too long",
-			(*payload)[0:maxPayloadLengthToLog], len(*payload)))
-	} else {
-		payloadToLog = payload
+func (t *Transport) redactor() *ocmlogger.Redactor {
+	if t.Redactor != nil {
+		return t.Redactor
 	}
-	return fmt.Sprintf("%s: %s", msg, *payloadToLog)
-}
-
-func (t *Transport) toPointer(str string) *string {
-	return &str
+	return ocmlogger.GetRedactor()
 }
 
 func (t *Transport) shouldLog(path string, includePrefixes []string, excludePrefixes []string) bool {
@@ -91,12 +103,3 @@ func (t *Transport) shouldLog(path string, includePrefixes []string, excludePref
 
 	return false
 }
-
-func (t *Transport) getPayload(ctx context.Context, body io.Reader) (payload string, err error) {
-	bytes, err := io.ReadAll(body)
-	if err != nil {
-		t.Logger.Error(ctx, "failed to read body")
-		return
-	}
-	return string(bytes), nil
-}
@@ -0,0 +1,210 @@
+package logging
+
+// This file contains tests for the body logging transport.
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+
+	sdklogging "github.com/openshift-online/ocm-sdk-go/logging"
+
+	. "github.com/onsi/ginkgo/v2/dsl/core"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("Transport", func() {
+	It("Redacts the logged URLs and bodies", func() {
+		// Create a server that echoes the secrets back:
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte(`{"access_token":"response-secret","expires_in":300}`))
+		}))
+		defer server.Close()
+
+		// Create a logger writing to a buffer:
+		buffer := &bytes.Buffer{}
+		logger, err := sdklogging.NewStdLoggerBuilder().
+			Streams(buffer, buffer).
+			Info(true).
+			Build()
+		Expect(err).ToNot(HaveOccurred())
+
+		client := &http.Client{
+			Transport: &Transport{
+				Logger:                  logger,
+				Wrapped:                 http.DefaultTransport,
+				LogRequestBodyPrefixes:  []string{""},
+				LogResponseBodyPrefixes: []string{""},
+			},
+		}
+		request, err := http.NewRequest(http.MethodPost, server.URL+"/token?api_key=query-secret",
+			strings.NewReader(`{"password":"request-secret","user":"jdoe"}`))
+		Expect(err).ToNot(HaveOccurred())
+		request.Header.Set("Content-Type", "application/json")
+		response, err := client.Do(request)
+		Expect(err).ToNot(HaveOccurred())
+		body, err := io.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+
+		// The caller still gets the real body:
+		Expect(string(body)).To(ContainSubstring("response-secret"))
+
+		// But the log doesn't contain any secret:
+		result := buffer.String()
+		Expect(result).To(ContainSubstring(`"user":"jdoe"`))
+		Expect(result).To(ContainSubstring(`"expires_in":300`))
+		Expect(result).ToNot(ContainSubstring("query-secret"))
+		Expect(result).ToNot(ContainSubstring("request-secret"))
+		Expect(result).ToNot(ContainSubstring("response-secret"))
+	})
+
+	It("Trims the bodies longer than the maximum length", func() {
+		payload := strings.Repeat("0123456789", 10)
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(payload))
+		}))
+		defer server.Close()
+		buffer := &bytes.Buffer{}
+		transport := newTestTransport(buffer)
+		transport.MaxBodyLength = 15
+
+		response, err := (&http.Client{Transport: transport}).Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+
+		// The response is logged once its body is read:
+		Expect(buffer.String()).ToNot(ContainSubstring("Got back"))
+		body, err := io.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(string(body)).To(Equal(payload))
+		Expect(buffer.String()).To(ContainSubstring(
+			"Got back http 200 for GET " + server.URL + ": 012345678901234... trimmed - payload length (100) is too long"))
+	})
+
+	It("Logs the response when its body is closed before the end", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			_, _ = w.Write([]byte(strings.Repeat("x", 1000)))
+		}))
+		defer server.Close()
+		buffer := &bytes.Buffer{}
+
+		response, err := (&http.Client{Transport: newTestTransport(buffer)}).Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = io.ReadFull(response.Body, make([]byte, 5))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("Got back http 200 for GET " + server.URL + ": xxxxx... trimmed"))
+		Expect(strings.Count(buffer.String(), "Got back")).To(Equal(1))
+	})
+
+	It("Doesn't log binary bodies", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/octet-stream")
+			_, _ = w.Write([]byte{0, 1, 2, 3})
+		}))
+		defer server.Close()
+		buffer := &bytes.Buffer{}
+
+		response, err := (&http.Client{Transport: newTestTransport(buffer)}).Get(server.URL)
+		Expect(err).ToNot(HaveOccurred())
+		_, err = io.ReadAll(response.Body)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(buffer.String()).To(ContainSubstring("[4 bytes of application/octet-stream omitted]"))
+	})
+
+	It("Logs the allowed headers, redacted", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Set-Cookie", "session=cookie-secret")
+			w.Header().Set("X-Operation-Id", "123")
+		}))
+		defer server.Close()
+		buffer := &bytes.Buffer{}
+		transport := newTestTransport(buffer)
+		transport.LogHeaders = []string{"authorization", "Accept", "Set-Cookie", "X-Missing"}
+
+		request, err := http.NewRequest(http.MethodGet, server.URL, nil)
+		Expect(err).ToNot(HaveOccurred())
+		request.Header.Set("Authorization", "Bearer token-secret")
+		request.Header.Set("Accept", "application/json")
+		request.Header.Set("User-Agent", "test")
+		response, err := (&http.Client{Transport: transport}).Do(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+
+		result := buffer.String()
+		Expect(result).To(ContainSubstring("{Authorization: [REDACTED], Accept: application/json}"))
+		Expect(result).To(ContainSubstring("[op-id=123] {Set-Cookie: [REDACTED]}"))
+		Expect(result).ToNot(ContainSubstring("secret"))
+		Expect(result).ToNot(ContainSubstring("User-Agent"))
+	})
+
+	It("Compacts the JSON bodies, or indents them", func() {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "application/json")
+			_, _ = w.Write([]byte("{\n  \"kind\": \"Cluster\",\n  \"id\": \"123\"\n}"))
+		}))
+		defer server.Close()
+		get := func(transport *Transport) {
+			response, err := (&http.Client{Transport: transport}).Get(server.URL)
+			Expect(err).ToNot(HaveOccurred())
+			_, err = io.ReadAll(response.Body)
+			Expect(err).ToNot(HaveOccurred())
+			Expect(response.Body.Close()).To(Succeed())
+		}
+
+		buffer := &bytes.Buffer{}
+		get(newTestTransport(buffer))
+		Expect(buffer.String()).To(ContainSubstring(`: {"id":"123","kind":"Cluster"}`))
+
+		buffer = &bytes.Buffer{}
+		transport := newTestTransport(buffer)
+		transport.PrettyJSON = true
+		get(transport)
+		Expect(buffer.String()).To(ContainSubstring("{\n  \"id\": \"123\",\n  \"kind\": \"Cluster\"\n}"))
+	})
+
+	It("Sends the whole request body after logging its beginning", func() {
+		var received []byte
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			received, _ = io.ReadAll(r.Body)
+		}))
+		defer server.Close()
+		buffer := &bytes.Buffer{}
+		transport := newTestTransport(buffer)
+		transport.MaxBodyLength = 3
+
+		// Without GetBody the transport can't read a copy of the body:
+		payload := strings.Repeat("abc", 100)
+		request, err := http.NewRequest(http.MethodPost, server.URL, io.NopCloser(strings.NewReader(payload)))
+		Expect(err).ToNot(HaveOccurred())
+		Expect(request.GetBody).To(BeNil())
+		response, err := (&http.Client{Transport: transport}).Do(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+
+		Expect(string(received)).To(Equal(payload))
+		Expect(buffer.String()).To(ContainSubstring("Sending POST " + server.URL + ": abc... trimmed\n"))
+	})
+})
+
+// newTestTransport returns a transport logging the bodies to the buffer.
+func newTestTransport(buffer *bytes.Buffer) *Transport {
+	logger, err := sdklogging.NewStdLoggerBuilder().
+		Streams(buffer, buffer).
+		Info(true).
+		Build()
+	Expect(err).ToNot(HaveOccurred())
+	return &Transport{
+		Logger:                  logger,
+		Wrapped:                 http.DefaultTransport,
+		LogRequestBodyPrefixes:  []string{""},
+		LogResponseBodyPrefixes: []string{""},
+	}
+}
@@ -7,8 +7,11 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/openshift-online/async-routine/opid"
@@ -18,22 +21,48 @@ import (
 // ContextKey is the type of keys used to store operation identifiers in contexts.
 type ContextKey int
 
+// Level is the level of the log messages written for the requests.
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelWarn
+	LevelError
+)
+
+// SkipPredicate tells if the details of a request shouldn't be written to the log.
+type SkipPredicate func(request *http.Request) bool
+
 // TransportWrapperBuilder contains the data and logic needed to create logging transport wrappers.
 type TransportWrapperBuilder struct {
-	logger sdklogging.Logger
+	logger           sdklogging.Logger
+	skipURLs         []string
+	skips            []SkipPredicate
+	successLevel     Level
+	clientErrorLevel Level
+	serverErrorLevel Level
+	failureLevel     Level
+	successSampling  float64
 }
 
 // TransportWrapper knows how to wrap an HTTP round tripper with another that writes to the log
 // details of the requests and responses.
 type TransportWrapper struct {
-	logger sdklogging.Logger
+	logger           sdklogging.Logger
+	skips            []SkipPredicate
+	successLevel     Level
+	clientErrorLevel Level
+	serverErrorLevel Level
+	failureLevel     Level
+	successSampling  float64
 }
 
 // roundTripper is an implementation of the http.RoundTripper interface that wrapps another round
 // tripper and writes to the log details of the requests and responses.
 type roundTripper struct {
-	logger sdklogging.Logger
-	next   http.RoundTripper
+	wrapper *TransportWrapper
+	next    http.RoundTripper
 }
 
 // responseBody is an implementation of the io.ReadCloser interface that allows us to capture the
@@ -41,6 +70,7 @@ type roundTripper struct {
 type responseBody struct {
 	ctx    context.Context
 	logger sdklogging.Logger
+	level  Level
 	method string
 	url    string
 	start  time.Time
@@ -51,7 +81,14 @@ type responseBody struct {
 // NewTransportWrapper creates a builder that can then be used to configure and create a logging
 // transport wrapper.
 func NewTransportWrapper() *TransportWrapperBuilder {
-	return &TransportWrapperBuilder{}
+	return &TransportWrapperBuilder{
+		skipURLs:         []string{leaderElectionURL},
+		successLevel:     LevelInfo,
+		clientErrorLevel: LevelInfo,
+		serverErrorLevel: LevelWarn,
+		failureLevel:     LevelError,
+		successSampling:  1,
+	}
 }
 
 // Logger sets the logger that will be used by the created round trippers to write details of the
@@ -61,6 +98,78 @@ func (b *TransportWrapperBuilder) Logger(value sdklogging.Logger) *TransportWrap
 	return b
 }
 
+// SkipURL adds a regular expression matched against the complete URLs of the requests that
+// shouldn't be written to the log. The requests of the Kubernetes API leader election, sent every
+// couple of seconds, are always skipped.
+func (b *TransportWrapperBuilder) SkipURL(value string) *TransportWrapperBuilder {
+	b.skipURLs = append(b.skipURLs, value)
+	return b
+}
+
+// SkipMethod adds methods, like `OPTIONS`, of the requests that shouldn't be written to the log.
+func (b *TransportWrapperBuilder) SkipMethod(values ...string) *TransportWrapperBuilder {
+	methods := slices.Clone(values)
+	return b.Skip(func(request *http.Request) bool {
+		return slices.ContainsFunc(methods, func(method string) bool {
+			return strings.EqualFold(method, request.Method)
+		})
+	})
+}
+
+// SkipHost adds host names, without port, of the requests that shouldn't be written to the log.
+func (b *TransportWrapperBuilder) SkipHost(values ...string) *TransportWrapperBuilder {
+	hosts := slices.Clone(values)
+	return b.Skip(func(request *http.Request) bool {
+		return slices.ContainsFunc(hosts, func(host string) bool {
+			return strings.EqualFold(host, request.URL.Hostname())
+		})
+	})
+}
+
+// Skip adds a predicate selecting requests that shouldn't be written to the log. A request is
+// skipped when any of the predicates, URLs, methods or hosts matches it.
+func (b *TransportWrapperBuilder) Skip(value SkipPredicate) *TransportWrapperBuilder {
+	b.skips = append(b.skips, value)
+	return b
+}
+
+// SuccessLevel sets the level of the messages of the requests that succeed, with a status code
+// lower than 400. The default is info, the level all requests were logged at before the levels
+// could be configured, so that existing services keep their logs; use debug to reduce the volume
+// of the successful requests.
+func (b *TransportWrapperBuilder) SuccessLevel(value Level) *TransportWrapperBuilder {
+	b.successLevel = value
+	return b
+}
+
+// ClientErrorLevel sets the level of the messages of the responses with a 4xx status code. The
+// default is info.
+func (b *TransportWrapperBuilder) ClientErrorLevel(value Level) *TransportWrapperBuilder {
+	b.clientErrorLevel = value
+	return b
+}
+
+// ServerErrorLevel sets the level of the messages of the responses with a 5xx status code. The
+// default is warn.
+func (b *TransportWrapperBuilder) ServerErrorLevel(value Level) *TransportWrapperBuilder {
+	b.serverErrorLevel = value
+	return b
+}
+
+// FailureLevel sets the level of the messages of the requests that get no response at all, for
+// example because the connection failed or the context was canceled. The default is error.
+func (b *TransportWrapperBuilder) FailureLevel(value Level) *TransportWrapperBuilder {
+	b.failureLevel = value
+	return b
+}
+
+// SuccessSampling sets the fraction, between 0 and 1, of the requests that succeed written to the
+// log. The requests that fail are always written. The default is 1, all of them.
+func (b *TransportWrapperBuilder) SuccessSampling(value float64) *TransportWrapperBuilder {
+	b.successSampling = value
+	return b
+}
+
 // Build uses the data stored in the builder to create a new wrapper.
 func (b *TransportWrapperBuilder) Build(ctx context.Context) (result *TransportWrapper, err error) {
 	// Check parameters:
@@ -68,10 +177,41 @@ func (b *TransportWrapperBuilder) Build(ctx context.Context) (result *TransportW
 		err = fmt.Errorf("logger is mandatory")
 		return
 	}
+	if b.successSampling < 0 || b.successSampling > 1 {
+		err = fmt.Errorf("success sampling should be between 0 and 1, but it is %g", b.successSampling)
+		return
+	}
+	for _, level := range []Level{b.successLevel, b.clientErrorLevel, b.serverErrorLevel, b.failureLevel} {
+		if level < LevelDebug || level > LevelError {
+			err = fmt.Errorf("log level %d isn't valid", level)
+			return
+		}
+	}
+
+	// Compile the regular expressions:
+	skips := make([]SkipPredicate, 0, len(b.skipURLs)+len(b.skips))
+	for _, expr := range b.skipURLs {
+		var re *regexp.Regexp
+		re, err = regexp.Compile(expr)
+		if err != nil {
+			err = fmt.Errorf("can't compile skipped URL regular expression '%s': %w", expr, err)
+			return
+		}
+		skips = append(skips, func(request *http.Request) bool {
+			return re.MatchString(request.URL.String())
+		})
+	}
+	skips = append(skips, b.skips...)
 
 	// Create and populate the object:
 	result = &TransportWrapper{
-		logger: b.logger,
+		logger:           b.logger,
+		skips:            skips,
+		successLevel:     b.successLevel,
+		clientErrorLevel: b.clientErrorLevel,
+		serverErrorLevel: b.serverErrorLevel,
+		failureLevel:     b.failureLevel,
+		successSampling:  b.successSampling,
 	}
 
 	return
@@ -81,8 +221,49 @@ func (b *TransportWrapperBuilder) Build(ctx context.Context) (result *TransportW
 // requests and responses.
 func (w *TransportWrapper) Wrap(next http.RoundTripper) http.RoundTripper {
 	return &roundTripper{
-		logger: w.logger,
-		next:   next,
+		wrapper: w,
+		next:    next,
+	}
+}
+
+// skip checks if the request matches any of the skip predicates.
+func (w *TransportWrapper) skip(request *http.Request) bool {
+	for _, skip := range w.skips {
+		if skip(request) {
+			return true
+		}
+	}
+	return false
+}
+
+// sampled decides if a request that succeeds will be written to the log.
+func (w *TransportWrapper) sampled() bool {
+	return w.successSampling >= 1 || rand.Float64() < w.successSampling
+}
+
+// responseLevel returns the level of the messages of a response with the given status code.
+func (w *TransportWrapper) responseLevel(status int) Level {
+	switch {
+	case status >= 500:
+		return w.serverErrorLevel
+	case status >= 400:
+		return w.clientErrorLevel
+	default:
+		return w.successLevel
+	}
+}
+
+// logAt writes a message with the given level.
+func logAt(ctx context.Context, logger sdklogging.Logger, level Level, format string, args ...interface{}) {
+	switch level {
+	case LevelDebug:
+		logger.Debug(ctx, format, args...)
+	case LevelInfo:
+		logger.Info(ctx, format, args...)
+	case LevelWarn:
+		logger.Warn(ctx, format, args...)
+	default:
+		logger.Error(ctx, format, args...)
 	}
 }
 
@@ -94,7 +275,7 @@ func (r *roundTripper) RoundTrip(request *http.Request) (response *http.Response
 	// Skip the requests for the URLs that are too noisy or not interesting:
 	method := request.Method
 	url := request.URL.String()
-	if skipRE.MatchString(url) {
+	if r.wrapper.skip(request) {
 		response, err = r.next.RoundTrip(request)
 		return
 	}
@@ -105,23 +286,38 @@ func (r *roundTripper) RoundTrip(request *http.Request) (response *http.Response
 	ctx = opid.WithOpId(ctx)
 	request = request.WithContext(ctx)
 
-	// Write the request details to the log:
-	r.logger.Info(
-		ctx,
-		"Sending '%s %s'",
-		method, url,
-	)
+	// Write the request details to the log, unless the request isn't sampled. In that case it is
+	// only written if the request fails, as the details of the response contain the method and
+	// the URL anyhow.
+	logger := r.wrapper.logger
+	sampled := r.wrapper.sampled()
+	if sampled {
+		logAt(
+			ctx, logger, r.wrapper.successLevel,
+			"Sending '%s %s'",
+			method, url,
+		)
+	}
 
 	// Send the request and wait for the response headers.
 	start := time.Now().UTC()
 	response, err = r.next.RoundTrip(request)
 	if err != nil {
+		logAt(
+			ctx, logger, r.wrapper.failureLevel,
+			"Request '%s %s' failed after %s: %v",
+			method, url, time.Since(start), err,
+		)
 		return
 	}
 	status := response.StatusCode
+	level := r.wrapper.responseLevel(status)
+	if status < 400 && !sampled {
+		return
+	}
 	duration := time.Since(start)
-	r.logger.Info(
-		ctx,
+	logAt(
+		ctx, logger, level,
 		"Received %d response for '%s %s' after %s",
 		status, method, url, duration,
 	)
@@ -131,7 +327,8 @@ func (r *roundTripper) RoundTrip(request *http.Request) (response *http.Response
 	// replace the response body with one that allows us to get that information.
 	response.Body = &responseBody{
 		ctx:    ctx,
-		logger: r.logger,
+		logger: logger,
+		level:  level,
 		method: method,
 		url:    url,
 		start:  start,
@@ -153,8 +350,8 @@ func (b *responseBody) Close() error {
 	// When the response body is closed we can write to the log the actual response details,
 	// specially the response length:
 	duration := time.Since(b.start)
-	b.logger.Info(
-		b.ctx,
+	logAt(
+		b.ctx, b.logger, b.level,
 		"Received %d bytes for '%s %s' after %s",
 		b.length, b.method, b.url, duration,
 	)
@@ -163,7 +360,6 @@ func (b *responseBody) Close() error {
 	return b.next.Close()
 }
 
-// skipRE is the regular expression that will be used to discard URLs that are too noisy or not
-// interesting. Kubernetes API leader election, for example, produces requests every two seconds and
-// it isn't useful to have that in the log.
-var skipRE = regexp.MustCompile("/namespaces/.*-leadership/")
+// leaderElectionURL is the regular expression that discards the URLs of the Kubernetes API leader
+// election. It produces requests every two seconds and it isn't useful to have that in the log.
+const leaderElectionURL = "/namespaces/.*-leadership/"
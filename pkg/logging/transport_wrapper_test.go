@@ -5,7 +5,11 @@ package logging
 import (
 	"context"
 	"errors"
+	"fmt"
+	"io"
 	"net/http"
+	"strings"
+	"sync"
 
 	sdklogging "github.com/openshift-online/ocm-sdk-go/logging"
 
@@ -39,8 +43,207 @@ var _ = Describe("Transport wrapper", func() {
 		Expect(err).To(HaveOccurred())
 		Expect(response).To(BeNil())
 	})
+
+	It("Writes the messages with the level of the outcome", func() {
+		ctx := context.Background()
+		logger := &recordingLogger{}
+		wrapper, err := NewTransportWrapper().
+			Logger(logger).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		for _, status := range []int{http.StatusOK, http.StatusNotFound, http.StatusServiceUnavailable} {
+			send(wrapper.Wrap(&statusRoundTripper{status: status}), http.MethodGet, "http://localhost/api")
+		}
+		_, err = wrapper.Wrap(&alwaysFailRoundTripper{}).RoundTrip(newRequest(http.MethodGet, "http://localhost/api"))
+		Expect(err).To(HaveOccurred())
+
+		Expect(logger.messages()).To(Equal([]string{
+			"info Sending 'GET http://localhost/api'",
+			"info Received 200 response",
+			"info Received 0 bytes",
+			"info Sending 'GET http://localhost/api'",
+			"info Received 404 response",
+			"info Received 0 bytes",
+			"info Sending 'GET http://localhost/api'",
+			"warn Received 503 response",
+			"warn Received 0 bytes",
+			"info Sending 'GET http://localhost/api'",
+			"error Request 'GET http://localhost/api' failed",
+		}))
+	})
+
+	It("Uses the configured levels", func() {
+		ctx := context.Background()
+		logger := &recordingLogger{}
+		wrapper, err := NewTransportWrapper().
+			Logger(logger).
+			SuccessLevel(LevelDebug).
+			ServerErrorLevel(LevelError).
+			FailureLevel(LevelWarn).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		send(wrapper.Wrap(&statusRoundTripper{status: http.StatusInternalServerError}), http.MethodGet,
+			"http://localhost/api")
+		_, err = wrapper.Wrap(&alwaysFailRoundTripper{}).RoundTrip(newRequest(http.MethodGet, "http://localhost/api"))
+		Expect(err).To(HaveOccurred())
+
+		Expect(logger.messages()).To(Equal([]string{
+			"debug Sending 'GET http://localhost/api'",
+			"error Received 500 response",
+			"error Received 0 bytes",
+			"debug Sending 'GET http://localhost/api'",
+			"warn Request 'GET http://localhost/api' failed",
+		}))
+	})
+
+	It("Skips the requests matching the predicates", func() {
+		ctx := context.Background()
+		logger := &recordingLogger{}
+		wrapper, err := NewTransportWrapper().
+			Logger(logger).
+			SkipURL("/healthz$").
+			SkipMethod("options").
+			SkipHost("metadata.internal").
+			Skip(func(request *http.Request) bool {
+				return request.Header.Get("X-Skip") != ""
+			}).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+		transport := wrapper.Wrap(&statusRoundTripper{status: http.StatusOK})
+
+		send(transport, http.MethodGet, "http://localhost/healthz")
+		send(transport, http.MethodOptions, "http://localhost/api")
+		send(transport, http.MethodGet, "http://metadata.internal:8080/token")
+		send(transport, http.MethodGet, "http://localhost/api/v1/namespaces/my-leadership/leases/my")
+		request := newRequest(http.MethodGet, "http://localhost/api")
+		request.Header.Set("X-Skip", "true")
+		response, err := transport.RoundTrip(request)
+		Expect(err).ToNot(HaveOccurred())
+		Expect(response.Body.Close()).To(Succeed())
+		Expect(logger.messages()).To(BeEmpty())
+
+		send(transport, http.MethodGet, "http://localhost/api")
+		Expect(logger.messages()).To(HaveLen(3))
+	})
+
+	It("Samples the requests that succeed, but not the ones that fail", func() {
+		ctx := context.Background()
+		logger := &recordingLogger{}
+		wrapper, err := NewTransportWrapper().
+			Logger(logger).
+			SuccessSampling(0).
+			Build(ctx)
+		Expect(err).ToNot(HaveOccurred())
+
+		send(wrapper.Wrap(&statusRoundTripper{status: http.StatusOK}), http.MethodGet, "http://localhost/api")
+		Expect(logger.messages()).To(BeEmpty())
+
+		send(wrapper.Wrap(&statusRoundTripper{status: http.StatusBadGateway}), http.MethodGet, "http://localhost/api")
+		_, err = wrapper.Wrap(&alwaysFailRoundTripper{}).RoundTrip(newRequest(http.MethodGet, "http://localhost/api"))
+		Expect(err).To(HaveOccurred())
+		Expect(logger.messages()).To(Equal([]string{
+			"warn Received 502 response",
+			"warn Received 0 bytes",
+			"error Request 'GET http://localhost/api' failed",
+		}))
+	})
+
+	It("Rejects invalid configurations", func() {
+		ctx := context.Background()
+		logger := &recordingLogger{}
+		_, err := NewTransportWrapper().Logger(logger).SkipURL("(").Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("can't compile skipped URL")))
+		_, err = NewTransportWrapper().Logger(logger).SuccessSampling(1.5).Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("between 0 and 1")))
+		_, err = NewTransportWrapper().Logger(logger).FailureLevel(Level(42)).Build(ctx)
+		Expect(err).To(MatchError(ContainSubstring("isn't valid")))
+	})
 })
 
+// send sends a request with the transport, and reads and closes the response body.
+func send(transport http.RoundTripper, method, url string) {
+	response, err := transport.RoundTrip(newRequest(method, url))
+	Expect(err).ToNot(HaveOccurred())
+	_, err = io.ReadAll(response.Body)
+	Expect(err).ToNot(HaveOccurred())
+	Expect(response.Body.Close()).To(Succeed())
+}
+
+func newRequest(method, url string) *http.Request {
+	request, err := http.NewRequest(method, url, nil)
+	Expect(err).ToNot(HaveOccurred())
+	return request
+}
+
+// statusRoundTripper is a round tripper that always returns an empty response with the status code.
+type statusRoundTripper struct {
+	status int
+}
+
+// RoundTrip is the implementation of the round tripper interface.
+func (t *statusRoundTripper) RoundTrip(request *http.Request) (response *http.Response, err error) {
+	response = &http.Response{
+		StatusCode: t.status,
+		Header:     http.Header{},
+		Body:       http.NoBody,
+		Request:    request,
+	}
+	return
+}
+
+// recordingLogger is a logger that keeps the level and the beginning of the messages, up to the
+// duration.
+type recordingLogger struct {
+	lock    sync.Mutex
+	entries []string
+}
+
+func (l *recordingLogger) record(level, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	if i := strings.Index(message, " for '"); i >= 0 && !strings.HasPrefix(message, "Sending") {
+		message = message[:i]
+	}
+	if i := strings.Index(message, " after "); i >= 0 {
+		message = message[:i]
+	}
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	l.entries = append(l.entries, level+" "+message)
+}
+
+func (l *recordingLogger) messages() []string {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.entries
+}
+
+func (l *recordingLogger) DebugEnabled() bool { return true }
+func (l *recordingLogger) InfoEnabled() bool  { return true }
+func (l *recordingLogger) WarnEnabled() bool  { return true }
+func (l *recordingLogger) ErrorEnabled() bool { return true }
+
+func (l *recordingLogger) Debug(ctx context.Context, format string, args ...interface{}) {
+	l.record("debug", format, args...)
+}
+
+func (l *recordingLogger) Info(ctx context.Context, format string, args ...interface{}) {
+	l.record("info", format, args...)
+}
+
+func (l *recordingLogger) Warn(ctx context.Context, format string, args ...interface{}) {
+	l.record("warn", format, args...)
+}
+
+func (l *recordingLogger) Error(ctx context.Context, format string, args ...interface{}) {
+	l.record("error", format, args...)
+}
+
+func (l *recordingLogger) Fatal(ctx context.Context, format string, args ...interface{}) {
+	l.record("fatal", format, args...)
+}
+
 // alwaysFailRoundTripper is a round tripper that always returns an error and no response.
 type alwaysFailRoundTripper struct {
 }
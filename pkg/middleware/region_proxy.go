@@ -8,7 +8,6 @@ import (
 	"net/url"
 	"time"
 
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	sdk "github.com/openshift-online/ocm-sdk-go"
 	"github.com/openshift-online/ocm-sdk-go/logging"
 	"github.com/pkg/errors"
@@ -16,18 +15,63 @@ import (
 )
 
 const (
-	defaultCacheSize       = 1000
-	defaultCacheExpireTime = time.Hour * 24
+	defaultCacheSize               = 1000
+	defaultCacheExpireTime         = time.Hour * 24
+	defaultNotFoundCacheExpireTime = time.Minute * 5
 )
 
-var requestsDispatched = prometheus.NewCounter(
+// values of the labels of the region proxy metrics
+const (
+	unknownRegionLabel = "unknown"
+
+	dispatchOutcomeDispatched  = "dispatched"
+	dispatchOutcomeFailed      = "failed"
+	dispatchOutcomeRefused     = "refused"
+	dispatchOutcomeCircuitOpen = "circuit_open"
+
+	cacheResultHit         = "hit"
+	cacheResultNegativeHit = "negative_hit"
+	cacheResultMiss        = "miss"
+
+	lookupResultFound    = "found"
+	lookupResultNotFound = "not_found"
+	lookupResultError    = "error"
+)
+
+var requestsDispatched = prometheus.NewCounterVec(
 	prometheus.CounterOpts{
 		Name: "region_proxy_dispatch_total",
-		Help: "The total number of requests dispatched by region proxy.",
+		Help: "The total number of requests dispatched by region proxy, by destination region and outcome.",
 	},
+	[]string{"region", "outcome"},
 )
 
-type getClusterIdsHandlerFunc func(context.Context, logging.Logger, *http.Request) ClusterIds
+var requestsServedLocally = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "region_proxy_local_total",
+		Help: "The total number of requests served locally by region proxy, by cluster region or unknown.",
+	},
+	[]string{"region"},
+)
+
+var cacheLookups = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "region_proxy_cache_lookups_total",
+		Help: "The total number of cluster region cache lookups, by result.",
+	},
+	[]string{"result"},
+)
+
+var regionLookupDuration = prometheus.NewHistogramVec(
+	prometheus.HistogramOpts{
+		Name:    "region_proxy_region_lookup_duration_seconds",
+		Help:    "The duration of the AMS lookups of cluster regions, by result.",
+		Buckets: prometheus.DefBuckets,
+	},
+	[]string{"result"},
+)
+
+type getClusterIdsHandlerFunc = ClusterIdsExtractor
 
 type checkLocalHandlerFunc func(context.Context, logging.Logger, ClusterIds) (bool, error)
 
@@ -36,6 +80,10 @@ type dispatchHandlerFunc func(context.Context, logging.Logger, http.ResponseWrit
 
 type errorHandlerFunc func(http.ResponseWriter, *http.Request, error)
 
+type regionURLHandlerFunc func(rhRegionId string) (*url.URL, error)
+
+type trustedPeerHandlerFunc func(*http.Request) bool
+
 type ClusterIds struct {
 	Id         string
 	ExternalId string
@@ -44,35 +92,64 @@ type ClusterIds struct {
 // Configuration for the region proxy middleware
 //   - logger: The logger used in middleware.
 //   - connection: The OCM SDK connection to use for the middleware.
-//   - clusterCache: the cache stored cluster's region info
-//   - getClusterIdsHandler: the function to retrieve cluster id/external_id from request
+//   - clusterCache: the cache stored cluster's region info, in memory unless configured otherwise
+//   - cacheSize, cacheTTL: the size of the cache and how long found regions are cached
+//   - notFoundCacheTTL: how long clusters not found in AMS are cached
+//   - errorCacheTTL: how long failed AMS lookups are cached, not cached by default
+//   - getClusterIdsHandler: the function to retrieve cluster id/external_id from request,
+//     DefaultClusterIdsExtractor unless configured otherwise
 //   - checkLocalHandler: the function to check whether cluster is located in local server
 //   - dispatchHandler: the function to dispatch the request
 //   - errorHandler: The optional function to handle the error
+//   - regionURLHandler: the function to compute the API URL of a region
+//   - localRegionId: the rh_region_id served by this instance, stamped as origin on dispatched requests
+//   - maxHops: the number of times a request may be dispatched before it is refused
+//   - trustedPeerHandler: the optional function telling whether a request comes from a peer region,
+//     whose hop header is trusted
+//   - circuits: the optional circuit breakers of the destination regions
 type RegionProxy struct {
 	logger               logging.Logger
 	connection           *sdk.Connection
-	clusterCache         *expirable.LRU[string, string]
+	clusterCache         RegionCache
+	cacheSize            int
+	cacheTTL             time.Duration
+	notFoundCacheTTL     time.Duration
+	errorCacheTTL        time.Duration
 	getClusterIdsHandler getClusterIdsHandlerFunc
 	checkLocalHandler    checkLocalHandlerFunc
 	dispatchHandler      dispatchHandlerFunc
 	errorHandler         errorHandlerFunc
+	regionURLHandler     regionURLHandlerFunc
+	localRegionId        string
+	maxHops              int
+	trustedPeerHandler   trustedPeerHandlerFunc
+	circuits             *circuitBreakers
 }
 
 func init() {
-	prometheus.MustRegister(requestsDispatched)
+	prometheus.MustRegister(requestsDispatched, requestsServedLocally, cacheLookups, regionLookupDuration)
 }
 
 func NewRegionProxy(ctx context.Context, options ...RegionProxyMiddwareOption) *RegionProxy {
 
-	regionProxyMiddleware := &RegionProxy{}
+	regionProxyMiddleware := &RegionProxy{
+		cacheSize:        defaultCacheSize,
+		cacheTTL:         defaultCacheExpireTime,
+		notFoundCacheTTL: defaultNotFoundCacheExpireTime,
+	}
 	for _, option := range options {
 		option(regionProxyMiddleware)
 	}
 
 	if regionProxyMiddleware.clusterCache == nil {
-		regionProxyMiddleware.clusterCache = expirable.NewLRU[string,
-			string](defaultCacheSize, nil, defaultCacheExpireTime)
+		// entries carry their own expiration, the LRU only needs to evict the longest lived ones
+		maxTTL := max(regionProxyMiddleware.cacheTTL, regionProxyMiddleware.notFoundCacheTTL,
+			regionProxyMiddleware.errorCacheTTL)
+		regionProxyMiddleware.clusterCache = NewInMemoryRegionCache(regionProxyMiddleware.cacheSize, maxTTL)
+	}
+
+	if regionProxyMiddleware.getClusterIdsHandler == nil {
+		regionProxyMiddleware.getClusterIdsHandler = DefaultClusterIdsExtractor()
 	}
 
 	if regionProxyMiddleware.logger == nil {
@@ -81,20 +158,31 @@ func NewRegionProxy(ctx context.Context, options ...RegionProxyMiddwareOption) *
 			Build()
 	}
 
+	if regionProxyMiddleware.regionURLHandler == nil {
+		regionProxyMiddleware.regionURLHandler = defaultRegionURLHandler
+	}
+
 	if regionProxyMiddleware.dispatchHandler == nil {
-		regionProxyMiddleware.dispatchHandler = defaultDispatchHandler()
+		regionProxyMiddleware.dispatchHandler = defaultDispatchHandler(regionProxyMiddleware.regionURLHandler)
+	}
+
+	if regionProxyMiddleware.maxHops <= 0 {
+		regionProxyMiddleware.maxHops = defaultMaxHops
 	}
 
 	if regionProxyMiddleware.errorHandler == nil {
 		regionProxyMiddleware.errorHandler = defaultErrorHandler()
 	}
 
+	if circuits := regionProxyMiddleware.circuits; circuits != nil && circuits.config.HealthCheckPath != "" {
+		circuits.startHealthChecks(ctx, regionProxyMiddleware.logger, regionProxyMiddleware.regionURLHandler)
+	}
+
 	return regionProxyMiddleware
 }
 
 func (rp *RegionProxy) Handler(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		var err error
 		ctx := r.Context()
 		ids := rp.getClusterIdsHandler(ctx, rp.logger, r)
 		if ids.Id == "" && ids.ExternalId == "" {
@@ -103,54 +191,160 @@ func (rp *RegionProxy) Handler(next http.Handler) http.Handler {
 			return
 		}
 
-		rhRegionId, found := rp.checkCache(ids.Id, ids.ExternalId)
-		if !found {
-			if rp.checkLocalHandler != nil {
-				exists, err := rp.checkLocalHandler(ctx, rp.logger, ids)
-				if err != nil {
-					rp.errorHandler(w, r, err)
-					return
-				}
-				if exists {
-					rp.updateCache("", ids.Id, ids.ExternalId)
-					next.ServeHTTP(w, r)
-					return
-				}
-			}
-			rhRegionId, err = getRhRegionId(ctx, rp.logger, ids, rp.connection)
-			rp.updateCache(rhRegionId, ids.Id, ids.ExternalId)
+		rhRegionId, err := rp.lookupRegion(ctx, ids)
+		if err != nil {
+			rp.errorHandler(w, r, err)
+			return
+		}
+
+		if rhRegionId != "" && rhRegionId == rp.localRegionId {
+			requestsServedLocally.WithLabelValues(rhRegionId).Inc()
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if rhRegionId == "" {
+			requestsServedLocally.WithLabelValues(unknownRegionLabel).Inc()
+			err = rp.dispatchHandler(ctx, rp.logger, w, r, next, rhRegionId)
 			if err != nil {
 				rp.errorHandler(w, r, err)
-				return
 			}
+			return
+		}
+
+		hop, err := nextHop(r, rp.localRegionId, rp.maxHops, rp.trustedPeerHandler == nil || rp.trustedPeerHandler(r))
+		if err != nil {
+			rp.logger.Warn(ctx, "Refusing to dispatch the request %s to '%s': %v", r.URL, rhRegionId, err)
+			requestsDispatched.WithLabelValues(rhRegionId, dispatchOutcomeRefused).Inc()
+			rp.errorHandler(w, r, err)
+			return
+		}
+		// per http.Handler contract the incoming request must not be modified
+		r = r.Clone(ctx)
+		stampDispatchHeaders(r, hop)
+
+		if rp.circuits != nil {
+			rp.dispatchWithCircuit(w, r, next, rhRegionId)
+			return
 		}
 
-		err = rp.dispatchHandler(ctx, rp.logger, w, r, next, rhRegionId)
+		recorder := &statusRecorder{ResponseWriter: w}
+		err = rp.dispatchHandler(ctx, rp.logger, recorder, r, next, rhRegionId)
+		countDispatch(rhRegionId, err, recorder.status)
 		if err != nil {
 			rp.errorHandler(w, r, err)
 		}
 	})
 }
 
-func defaultDispatchHandler() dispatchHandlerFunc {
+// lookupRegion returns the rh_region_id of the cluster, empty when the cluster is served by this
+// instance. The local check and AMS are only used when the result isn't cached.
+func (rp *RegionProxy) lookupRegion(ctx context.Context, ids ClusterIds) (string, error) {
+	entry, found := rp.checkCache(ctx, ids.Id, ids.ExternalId)
+	if found {
+		if entry.NotFound || entry.LookupError != "" {
+			cacheLookups.WithLabelValues(cacheResultNegativeHit).Inc()
+		} else {
+			cacheLookups.WithLabelValues(cacheResultHit).Inc()
+		}
+		if entry.LookupError != "" {
+			return "", errors.New(entry.LookupError)
+		}
+		return entry.RhRegionId, nil
+	}
+	cacheLookups.WithLabelValues(cacheResultMiss).Inc()
+
+	if rp.checkLocalHandler != nil {
+		exists, err := rp.checkLocalHandler(ctx, rp.logger, ids)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			rp.updateCache(ctx, "", ids)
+			return "", nil
+		}
+	}
+
+	start := time.Now()
+	rhRegionId, exists, err := getRhRegionId(ctx, rp.logger, ids, rp.connection)
+	switch {
+	case err != nil:
+		regionLookupDuration.WithLabelValues(lookupResultError).Observe(time.Since(start).Seconds())
+		rp.cacheEntry(ctx, RegionCacheEntry{LookupError: err.Error()}, rp.errorCacheTTL, ids)
+	case !exists:
+		regionLookupDuration.WithLabelValues(lookupResultNotFound).Observe(time.Since(start).Seconds())
+		rp.cacheEntry(ctx, RegionCacheEntry{NotFound: true}, rp.notFoundCacheTTL, ids)
+	default:
+		regionLookupDuration.WithLabelValues(lookupResultFound).Observe(time.Since(start).Seconds())
+		rp.updateCache(ctx, rhRegionId, ids)
+	}
+	return rhRegionId, err
+}
+
+// CircuitState returns the state of the circuit breaker of a destination region, regions
+// without circuit breaking configured are always closed.
+func (rp *RegionProxy) CircuitState(rhRegionId string) CircuitState {
+	if rp.circuits == nil {
+		return CircuitClosed
+	}
+	return rp.circuits.state(rhRegionId)
+}
+
+func (rp *RegionProxy) dispatchWithCircuit(w http.ResponseWriter, r *http.Request, next http.Handler,
+	rhRegionId string) {
+	ctx := r.Context()
+	allowed, retryAfter := rp.circuits.allow(rhRegionId)
+	if !allowed {
+		rp.logger.Warn(ctx, "Circuit of region '%s' is open, not dispatching the request %s", rhRegionId, r.URL)
+		requestsDispatched.WithLabelValues(rhRegionId, dispatchOutcomeCircuitOpen).Inc()
+		rp.circuits.serveCircuitOpen(w, r, next, rhRegionId, retryAfter)
+		return
+	}
+
+	recorder := &statusRecorder{ResponseWriter: w}
+	start := time.Now()
+	var err error
+	returned := false
+	defer func() {
+		// a panicking dispatch is a failure, and must release the probe of a half-open circuit
+		rp.circuits.record(rhRegionId, returned && err == nil && !dispatchFailed(recorder.status), time.Since(start))
+	}()
+	err = rp.dispatchHandler(ctx, rp.logger, recorder, r, next, rhRegionId)
+	returned = true
+	countDispatch(rhRegionId, err, recorder.status)
+	if err != nil {
+		rp.errorHandler(w, r, err)
+	}
+}
+
+// defaultRegionURLHandler maps a rh_region_id to the public API of the region:
+//
+//	"rh_region_id":"aws.ap-southeast-1.integration" => api.aws.ap-southeast-1.integration.openshift.com
+//	"rh_region_id":"aws.ap-southeast-1.stage" => api.aws.ap-southeast-1.stage.openshift.com
+//	"rh_region_id":"aws.ap-southeast-1" => api.aws.ap-southeast-1.openshift.com
+func defaultRegionURLHandler(rhRegionId string) (*url.URL, error) {
+	dispatchHost := fmt.Sprintf("https://api.%s.openshift.com", rhRegionId)
+	dispatchURL, err := url.Parse(dispatchHost)
+	if err != nil {
+		return nil, err
+	}
+	if dispatchURL.Scheme == "" {
+		dispatchURL = &url.URL{
+			Host:   dispatchHost,
+			Scheme: "https"}
+	}
+	return dispatchURL, nil
+}
+
+func defaultDispatchHandler(regionURLHandler regionURLHandlerFunc) dispatchHandlerFunc {
 	return func(ctx context.Context, logger logging.Logger, w http.ResponseWriter, r *http.Request,
 		next http.Handler, rhRegionId string) error {
 		if rhRegionId != "" {
-			// "rh_region_id":"aws.ap-southeast-1.integration" => api.aws.ap-southeast-1.integration.openshift.com
-			// "rh_region_id":"aws.ap-southeast-1.stage" => api.aws.ap-southeast-1.stage.openshift.com
-			// "rh_region_id":"aws.ap-southeast-1" => api.aws.ap-southeast-1.openshift.com
-			dispatchHost := fmt.Sprintf("https://api.%s.openshift.com", rhRegionId)
-			logger.Info(ctx, "Dispatch the request %s to %s", r.URL, dispatchHost)
-			requestsDispatched.Inc()
-			dispatchURL, err := url.Parse(dispatchHost)
+			dispatchURL, err := regionURLHandler(rhRegionId)
 			if err != nil {
 				return err
 			}
-			if dispatchURL.Scheme == "" {
-				dispatchURL = &url.URL{
-					Host:   dispatchHost,
-					Scheme: "https"}
-			}
+			logger.Info(ctx, "Dispatch the request %s to %s", r.URL, dispatchURL)
 			r.Host = dispatchURL.Host
 			proxy := httputil.NewSingleHostReverseProxy(dispatchURL)
 			defer func() {
@@ -172,15 +366,30 @@ func defaultDispatchHandler() dispatchHandlerFunc {
 	}
 }
 
+// countDispatch updates the dispatch metric with the outcome of a request sent to another region.
+func countDispatch(rhRegionId string, err error, status int) {
+	outcome := dispatchOutcomeDispatched
+	if err != nil || dispatchFailed(status) {
+		outcome = dispatchOutcomeFailed
+	}
+	requestsDispatched.WithLabelValues(rhRegionId, outcome).Inc()
+}
+
 func defaultErrorHandler() errorHandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request, err error) {
-		w.WriteHeader(http.StatusInternalServerError)
+		if errors.Is(err, ErrHopLimitExceeded) {
+			w.WriteHeader(http.StatusLoopDetected)
+		} else {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
 		w.Write([]byte(fmt.Sprintf("Error in region proxy: %v", err)))
 	}
 }
 
+// getRhRegionId searches the subscription of the cluster in AMS, the second return value is false
+// when there is no such subscription.
 func getRhRegionId(ctx context.Context, logger logging.Logger,
-	ids ClusterIds, connection *sdk.Connection) (string, error) {
+	ids ClusterIds, connection *sdk.Connection) (string, bool, error) {
 	var search string
 	if ids.Id != "" {
 		search = fmt.Sprintf("cluster_id='%s'", ids.Id)
@@ -190,28 +399,10 @@ func getRhRegionId(ctx context.Context, logger logging.Logger,
 	resp, err := connection.AccountsMgmt().V1().Subscriptions().List().Search(search).SendContext(ctx)
 	if err != nil {
 		logger.Error(ctx, "Failed to list cluster in AMS: %v", err)
-		return "", err
+		return "", false, err
 	}
 	if resp.Items().Len() > 0 {
-		return resp.Items().Get(0).RhRegionID(), nil
-	}
-	return "", nil
-}
-
-func (rp *RegionProxy) checkCache(ids ...string) (string, bool) {
-	for _, id := range ids {
-		value, found := rp.clusterCache.Get(id)
-		if found {
-			return value, found
-		}
-	}
-	return "", false
-}
-
-func (rp *RegionProxy) updateCache(rhRegionID string, ids ...string) {
-	for _, id := range ids {
-		if id != "" {
-			rp.clusterCache.Add(id, rhRegionID)
-		}
+		return resp.Items().Get(0).RhRegionID(), true, nil
 	}
+	return "", false, nil
 }
@@ -0,0 +1,169 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/hashicorp/golang-lru/v2/expirable"
+)
+
+// RegionCacheEntry is the cached result of looking up the region of a cluster. Entries for clusters
+// not found in AMS and for failed lookups are cached for a shorter time than regular ones. The
+// entry is stored under both the id and the external id of the cluster, and carries both so that
+// invalidating one of them removes the other as well.
+type RegionCacheEntry struct {
+	ClusterId         string    `json:"cluster_id,omitempty"`
+	ExternalClusterId string    `json:"external_cluster_id,omitempty"`
+	RhRegionId        string    `json:"rh_region_id"`
+	NotFound          bool      `json:"not_found,omitempty"`
+	LookupError       string    `json:"lookup_error,omitempty"`
+	ExpiresAt         time.Time `json:"expires_at"`
+}
+
+// RegionCache stores the region of clusters. Implementations must be safe for concurrent use,
+// and may be backed by a store shared by all the replicas of a service so that invalidations are
+// seen everywhere. The region proxy ignores entries past their ExpiresAt, so implementations may
+// treat the ttl as a hint.
+type RegionCache interface {
+	Get(ctx context.Context, key string) (RegionCacheEntry, bool)
+	Add(ctx context.Context, key string, entry RegionCacheEntry, ttl time.Duration)
+	Remove(ctx context.Context, key string)
+	Purge(ctx context.Context)
+}
+
+type inMemoryRegionCache struct {
+	lru *expirable.LRU[string, RegionCacheEntry]
+}
+
+var _ RegionCache = &inMemoryRegionCache{}
+
+// NewInMemoryRegionCache creates the default, per process, region cache. Entries are evicted when
+// the size is exceeded or after maxTTL, whichever comes first.
+func NewInMemoryRegionCache(size int, maxTTL time.Duration) RegionCache {
+	return &inMemoryRegionCache{
+		lru: expirable.NewLRU[string, RegionCacheEntry](size, nil, maxTTL),
+	}
+}
+
+func (c *inMemoryRegionCache) Get(_ context.Context, key string) (RegionCacheEntry, bool) {
+	return c.lru.Get(key)
+}
+
+func (c *inMemoryRegionCache) Add(_ context.Context, key string, entry RegionCacheEntry, _ time.Duration) {
+	c.lru.Add(key, entry)
+}
+
+func (c *inMemoryRegionCache) Remove(_ context.Context, key string) {
+	c.lru.Remove(key)
+}
+
+func (c *inMemoryRegionCache) Purge(_ context.Context) {
+	c.lru.Purge()
+}
+
+// Invalidate removes the cached region of the given clusters, identified by id or external id,
+// so that the next request for them looks the region up again. It is meant to be called when a
+// cluster is known to have moved between regions.
+func (rp *RegionProxy) Invalidate(ctx context.Context, clusterIds ...string) {
+	for _, id := range clusterIds {
+		if id == "" {
+			continue
+		}
+		if entry, found := rp.clusterCache.Get(ctx, id); found {
+			for _, key := range []string{entry.ClusterId, entry.ExternalClusterId} {
+				if key != "" {
+					rp.clusterCache.Remove(ctx, key)
+				}
+			}
+		}
+		rp.clusterCache.Remove(ctx, id)
+	}
+}
+
+// Purge removes the cached region of all the clusters.
+func (rp *RegionProxy) Purge(ctx context.Context) {
+	rp.clusterCache.Purge(ctx)
+}
+
+// CacheAdminHandler returns a handler to inspect and drive the cluster region cache:
+//   - GET ?cluster_id=<id> returns the cached entry of the cluster, or 404
+//   - DELETE ?cluster_id=<id>[&cluster_id=<id>...] invalidates the given clusters
+//   - DELETE ?all=true purges the whole cache
+//
+// Ids may be cluster ids or external cluster ids. The handler doesn't authenticate its callers, it
+// must be mounted on an admin only route.
+func (rp *RegionProxy) CacheAdminHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		query := r.URL.Query()
+		ids := query["cluster_id"]
+		switch r.Method {
+		case http.MethodGet:
+			if len(ids) != 1 {
+				http.Error(w, "exactly one cluster_id is required", http.StatusBadRequest)
+				return
+			}
+			entry, found := rp.checkCache(ctx, ids[0])
+			if !found {
+				http.Error(w, "cluster is not cached", http.StatusNotFound)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			_ = json.NewEncoder(w).Encode(entry)
+		case http.MethodDelete:
+			switch {
+			case query.Get("all") == "true":
+				rp.logger.Info(ctx, "Purging the region proxy cache")
+				rp.Purge(ctx)
+			case len(ids) > 0:
+				rp.logger.Info(ctx, "Invalidating the region proxy cache for clusters %v", ids)
+				rp.Invalidate(ctx, ids...)
+			default:
+				http.Error(w, "cluster_id or all=true is required", http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		}
+	})
+}
+
+func (rp *RegionProxy) checkCache(ctx context.Context, ids ...string) (RegionCacheEntry, bool) {
+	for _, id := range ids {
+		if id == "" {
+			continue
+		}
+		entry, found := rp.clusterCache.Get(ctx, id)
+		if !found {
+			continue
+		}
+		if time.Now().After(entry.ExpiresAt) {
+			rp.clusterCache.Remove(ctx, id)
+			continue
+		}
+		return entry, true
+	}
+	return RegionCacheEntry{}, false
+}
+
+func (rp *RegionProxy) updateCache(ctx context.Context, rhRegionID string, ids ClusterIds) {
+	rp.cacheEntry(ctx, RegionCacheEntry{RhRegionId: rhRegionID}, rp.cacheTTL, ids)
+}
+
+func (rp *RegionProxy) cacheEntry(ctx context.Context, entry RegionCacheEntry, ttl time.Duration, ids ClusterIds) {
+	if ttl <= 0 {
+		return
+	}
+	entry.ClusterId = ids.Id
+	entry.ExternalClusterId = ids.ExternalId
+	entry.ExpiresAt = time.Now().Add(ttl)
+	for _, id := range []string{ids.Id, ids.ExternalId} {
+		if id != "" {
+			rp.clusterCache.Add(ctx, id, entry, ttl)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+)
+
+var clusterIds = ClusterIds{Id: clusterId, ExternalId: clusterExternalId}
+
+// mapRegionCache is a RegionCache standing in for a shared store.
+type mapRegionCache struct {
+	lock    sync.Mutex
+	entries map[string]RegionCacheEntry
+}
+
+func (c *mapRegionCache) Get(_ context.Context, key string) (RegionCacheEntry, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	entry, found := c.entries[key]
+	return entry, found
+}
+
+func (c *mapRegionCache) Add(_ context.Context, key string, entry RegionCacheEntry, _ time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries[key] = entry
+}
+
+func (c *mapRegionCache) Remove(_ context.Context, key string) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	delete(c.entries, key)
+}
+
+func (c *mapRegionCache) Purge(_ context.Context) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.entries = map[string]RegionCacheEntry{}
+}
+
+func TestInvalidateRemovesBothIds(t *testing.T) {
+	RegisterTestingT(t)
+	ctx := context.Background()
+	middleware := NewRegionProxy(ctx, WithSDKConnection(connection))
+	middleware.updateCache(ctx, APRhRegionId, clusterIds)
+	middleware.updateCache(ctx, APRhRegionId, ClusterIds{Id: clusterId1, ExternalId: clusterExternalId1})
+
+	middleware.Invalidate(ctx, clusterExternalId)
+	_, found := middleware.checkCache(ctx, clusterId)
+	Expect(found).To(BeFalse())
+	_, found = middleware.checkCache(ctx, clusterExternalId)
+	Expect(found).To(BeFalse())
+	_, found = middleware.checkCache(ctx, clusterId1)
+	Expect(found).To(BeTrue())
+
+	middleware.Purge(ctx)
+	_, found = middleware.checkCache(ctx, clusterId1, clusterExternalId1)
+	Expect(found).To(BeFalse())
+}
+
+func TestInvalidatedClusterIsLookedUpAgain(t *testing.T) {
+	RegisterTestingT(t)
+	calledNext = false
+	callDispatched = false
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(mockDispatchFunc),
+	)
+	middleware.updateCache(context.Background(), "", clusterIds)
+	router := middleware.Handler(nextHandler)
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(calledNext).To(BeTrue())
+
+	// the cluster migrated to another region
+	mockAMSServer.AppendHandlers(mockResponseFromAMS(true, APRhRegionId))
+	middleware.Invalidate(context.Background(), clusterId)
+	calledNext = false
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(calledNext).To(BeFalse())
+	Expect(callDispatched).To(BeTrue())
+}
+
+func TestCustomRegionCache(t *testing.T) {
+	RegisterTestingT(t)
+	cache := &mapRegionCache{entries: map[string]RegionCacheEntry{}}
+	middleware := NewRegionProxy(context.Background(), WithSDKConnection(connection), WithRegionCache(cache))
+	middleware.updateCache(context.Background(), APRhRegionId, clusterIds)
+
+	Expect(cache.entries).To(HaveLen(2))
+	Expect(cache.entries[clusterExternalId].RhRegionId).To(Equal(APRhRegionId))
+	Expect(cache.entries[clusterExternalId].ClusterId).To(Equal(clusterId))
+
+	// expired entries are ignored even if the cache still returns them
+	cache.entries[clusterId] = RegionCacheEntry{RhRegionId: APRhRegionId, ExpiresAt: time.Now().Add(-time.Second)}
+	_, found := middleware.checkCache(context.Background(), clusterId)
+	Expect(found).To(BeFalse())
+	Expect(cache.entries).NotTo(HaveKey(clusterId))
+}
+
+func TestCacheAdminHandler(t *testing.T) {
+	RegisterTestingT(t)
+	ctx := context.Background()
+	middleware := NewRegionProxy(ctx, WithSDKConnection(connection))
+	middleware.updateCache(ctx, APRhRegionId, clusterIds)
+	handler := middleware.CacheAdminHandler()
+
+	serve := func(method, target string) *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, target, nil))
+		return recorder
+	}
+
+	recorder := serve(http.MethodGet, "/?cluster_id="+clusterExternalId)
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	entry := RegionCacheEntry{}
+	Expect(json.Unmarshal(recorder.Body.Bytes(), &entry)).To(Succeed())
+	Expect(entry.RhRegionId).To(Equal(APRhRegionId))
+	Expect(entry.ClusterId).To(Equal(clusterId))
+
+	Expect(serve(http.MethodGet, "/").Code).To(Equal(http.StatusBadRequest))
+	Expect(serve(http.MethodDelete, "/").Code).To(Equal(http.StatusBadRequest))
+	Expect(serve(http.MethodPost, "/").Code).To(Equal(http.StatusMethodNotAllowed))
+
+	Expect(serve(http.MethodDelete, "/?cluster_id="+clusterId).Code).To(Equal(http.StatusNoContent))
+	Expect(serve(http.MethodGet, "/?cluster_id="+clusterExternalId).Code).To(Equal(http.StatusNotFound))
+
+	middleware.updateCache(ctx, APRhRegionId, clusterIds)
+	Expect(serve(http.MethodDelete, "/?all=true").Code).To(Equal(http.StatusNoContent))
+	Expect(serve(http.MethodGet, "/?cluster_id="+clusterId).Code).To(Equal(http.StatusNotFound))
+}
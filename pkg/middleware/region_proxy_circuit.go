@@ -0,0 +1,354 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/openshift-online/ocm-sdk-go/logging"
+	"github.com/prometheus/client_golang/prometheus"
+
+	ocmerrors "github.com/openshift-online/ocm-service-common/pkg/error"
+)
+
+const (
+	defaultCircuitFailureThreshold    = 5
+	defaultCircuitOpenTimeout         = 30 * time.Second
+	defaultCircuitHalfOpenProbes      = 1
+	defaultCircuitHealthCheckInterval = 30 * time.Second
+)
+
+// CircuitOpenFallback decides what happens to a request for a region whose circuit is open.
+type CircuitOpenFallback int
+
+const (
+	// FailFast answers with a structured 503 error without contacting the region.
+	FailFast CircuitOpenFallback = iota
+	// ServeLocally hands the request to the next handler, as if the cluster was local.
+	ServeLocally
+)
+
+func (f CircuitOpenFallback) String() string {
+	if f == ServeLocally {
+		return "serve_locally"
+	}
+	return "fail_fast"
+}
+
+// CircuitState is the state of the circuit breaker of a destination region.
+type CircuitState int
+
+const (
+	CircuitClosed CircuitState = iota
+	CircuitHalfOpen
+	CircuitOpen
+)
+
+func (s CircuitState) String() string {
+	switch s {
+	case CircuitHalfOpen:
+		return "half_open"
+	case CircuitOpen:
+		return "open"
+	default:
+		return "closed"
+	}
+}
+
+// CircuitBreakerConfig configures the per region circuit breaking of the region proxy. Zero
+// values are replaced with defaults.
+//   - FailureThreshold: consecutive failed dispatches, or health checks, that open the circuit of a
+//     region
+//   - LatencyThreshold: when set, dispatches slower than this are counted as failures
+//   - OpenTimeout: how long a circuit stays open before probe requests are let through
+//   - HalfOpenProbes: concurrent probe requests allowed while the circuit is half-open
+//   - HealthCheckPath: when set, the path requested on every known region to track its health
+//   - HealthCheckInterval: how often the health check endpoint is requested
+//   - Fallback: what to do with requests for a region whose circuit is open
+type CircuitBreakerConfig struct {
+	FailureThreshold    int
+	LatencyThreshold    time.Duration
+	OpenTimeout         time.Duration
+	HalfOpenProbes      int
+	HealthCheckPath     string
+	HealthCheckInterval time.Duration
+	Fallback            CircuitOpenFallback
+}
+
+var circuitState = prometheus.NewGaugeVec(
+	prometheus.GaugeOpts{
+		Name: "region_proxy_circuit_state",
+		Help: "The state of the circuit breaker of each destination region: 0 closed, 1 half open, 2 open.",
+	},
+	[]string{"region"},
+)
+
+var circuitRejected = prometheus.NewCounterVec(
+	prometheus.CounterOpts{
+		Name: "region_proxy_circuit_rejected_total",
+		Help: "The total number of requests not dispatched because the circuit of the region was open.",
+	},
+	[]string{"region", "fallback"},
+)
+
+func init() {
+	prometheus.MustRegister(circuitState, circuitRejected)
+}
+
+type regionCircuit struct {
+	state                     CircuitState
+	consecutiveFailures       int
+	consecutiveHealthFailures int
+	openedAt                  time.Time
+	probesInFlight            int
+}
+
+// circuitBreakers tracks the circuit of every region the proxy dispatched requests to.
+type circuitBreakers struct {
+	config  CircuitBreakerConfig
+	lock    sync.Mutex
+	regions map[string]*regionCircuit
+	now     func() time.Time
+}
+
+func newCircuitBreakers(config CircuitBreakerConfig) *circuitBreakers {
+	if config.FailureThreshold <= 0 {
+		config.FailureThreshold = defaultCircuitFailureThreshold
+	}
+	if config.OpenTimeout <= 0 {
+		config.OpenTimeout = defaultCircuitOpenTimeout
+	}
+	if config.HalfOpenProbes <= 0 {
+		config.HalfOpenProbes = defaultCircuitHalfOpenProbes
+	}
+	if config.HealthCheckInterval <= 0 {
+		config.HealthCheckInterval = defaultCircuitHealthCheckInterval
+	}
+	return &circuitBreakers{
+		config:  config,
+		regions: map[string]*regionCircuit{},
+		now:     time.Now,
+	}
+}
+
+// state returns the current state of the circuit of a region.
+func (c *circuitBreakers) state(region string) CircuitState {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if circuit, found := c.regions[region]; found {
+		return circuit.state
+	}
+	return CircuitClosed
+}
+
+// allow tells whether a request may be dispatched to the region, and when it may not, how long
+// until the circuit lets probe requests through again.
+func (c *circuitBreakers) allow(region string) (bool, time.Duration) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	circuit := c.circuit(region)
+	if circuit.state == CircuitOpen {
+		elapsed := c.now().Sub(circuit.openedAt)
+		if elapsed < c.config.OpenTimeout {
+			return false, c.config.OpenTimeout - elapsed
+		}
+		c.transition(region, circuit, CircuitHalfOpen)
+	}
+	if circuit.state == CircuitHalfOpen {
+		if circuit.probesInFlight >= c.config.HalfOpenProbes {
+			return false, 0
+		}
+		circuit.probesInFlight++
+	}
+	return true, 0
+}
+
+// record updates the circuit of a region with the outcome of a dispatch.
+func (c *circuitBreakers) record(region string, success bool, latency time.Duration) {
+	if c.config.LatencyThreshold > 0 && latency > c.config.LatencyThreshold {
+		success = false
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	circuit := c.circuit(region)
+	switch circuit.state {
+	case CircuitHalfOpen:
+		if circuit.probesInFlight > 0 {
+			circuit.probesInFlight--
+		}
+		if success {
+			c.transition(region, circuit, CircuitClosed)
+		} else {
+			c.transition(region, circuit, CircuitOpen)
+		}
+	case CircuitClosed:
+		if success {
+			circuit.consecutiveFailures = 0
+			return
+		}
+		circuit.consecutiveFailures++
+		if circuit.consecutiveFailures >= c.config.FailureThreshold {
+			c.transition(region, circuit, CircuitOpen)
+		}
+	}
+}
+
+// recordHealth updates the circuit of a region with the outcome of a health check. A healthy
+// region whose circuit is open is moved to half-open so that real requests probe it, the circuit
+// of an unhealthy one opens after FailureThreshold consecutive failed health checks.
+func (c *circuitBreakers) recordHealth(region string, healthy bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	circuit := c.circuit(region)
+	if healthy {
+		circuit.consecutiveHealthFailures = 0
+		if circuit.state == CircuitOpen {
+			c.transition(region, circuit, CircuitHalfOpen)
+		}
+		return
+	}
+	if circuit.state == CircuitOpen {
+		return
+	}
+	circuit.consecutiveHealthFailures++
+	if circuit.consecutiveHealthFailures >= c.config.FailureThreshold {
+		c.transition(region, circuit, CircuitOpen)
+	}
+}
+
+func (c *circuitBreakers) knownRegions() []string {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	regions := make([]string, 0, len(c.regions))
+	for region := range c.regions {
+		regions = append(regions, region)
+	}
+	return regions
+}
+
+// circuit must be called with the lock held.
+func (c *circuitBreakers) circuit(region string) *regionCircuit {
+	circuit, found := c.regions[region]
+	if !found {
+		circuit = &regionCircuit{}
+		c.regions[region] = circuit
+		circuitState.WithLabelValues(region).Set(float64(CircuitClosed))
+	}
+	return circuit
+}
+
+// transition must be called with the lock held.
+func (c *circuitBreakers) transition(region string, circuit *regionCircuit, state CircuitState) {
+	circuit.state = state
+	circuit.consecutiveFailures = 0
+	circuit.consecutiveHealthFailures = 0
+	circuit.probesInFlight = 0
+	if state == CircuitOpen {
+		circuit.openedAt = c.now()
+	}
+	circuitState.WithLabelValues(region).Set(float64(state))
+}
+
+// startHealthChecks periodically requests the health check endpoint of every region the proxy
+// has dispatched requests to, until the context is cancelled.
+func (c *circuitBreakers) startHealthChecks(ctx context.Context, logger logging.Logger,
+	regionURLHandler regionURLHandlerFunc) {
+	client := &http.Client{Timeout: c.config.HealthCheckInterval}
+	ticker := time.NewTicker(c.config.HealthCheckInterval)
+	go func() {
+		for {
+			select {
+			case <-ticker.C:
+				for _, region := range c.knownRegions() {
+					c.recordHealth(region, c.checkHealth(ctx, logger, client, regionURLHandler, region))
+				}
+			case <-ctx.Done():
+				ticker.Stop()
+				return
+			}
+		}
+	}()
+}
+
+func (c *circuitBreakers) checkHealth(ctx context.Context, logger logging.Logger, client *http.Client,
+	regionURLHandler regionURLHandlerFunc, region string) bool {
+	regionURL, err := regionURLHandler(region)
+	if err != nil {
+		logger.Warn(ctx, "Cannot compute the URL of region '%s' for health check: %v", region, err)
+		return false
+	}
+	healthURL := regionURL.JoinPath(c.config.HealthCheckPath).String()
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, healthURL, nil)
+	if err != nil {
+		return false
+	}
+	response, err := client.Do(request)
+	if err != nil {
+		logger.Warn(ctx, "Health check of region '%s' failed: %v", region, err)
+		return false
+	}
+	defer response.Body.Close()
+	return response.StatusCode < http.StatusInternalServerError
+}
+
+// serveCircuitOpen applies the configured fallback to a request for a region whose circuit is open.
+func (c *circuitBreakers) serveCircuitOpen(w http.ResponseWriter, r *http.Request, next http.Handler,
+	region string, retryAfter time.Duration) {
+	circuitRejected.WithLabelValues(region, c.config.Fallback.String()).Inc()
+	if c.config.Fallback == ServeLocally {
+		next.ServeHTTP(w, r)
+		return
+	}
+
+	body := ocmerrors.Error{
+		Kind:      "Error",
+		ID:        strconv.Itoa(http.StatusServiceUnavailable),
+		Code:      "REGION-PROXY-503",
+		Reason:    fmt.Sprintf("Region '%s' is temporarily unavailable", region),
+		Timestamp: time.Now().UTC(),
+	}
+	if retryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(retryAfter.Seconds()))))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusServiceUnavailable)
+	_ = json.NewEncoder(w).Encode(body)
+}
+
+// dispatchFailed tells whether the status returned by a dispatched request means the region
+// could not be reached, as opposed to an application level error of the regional API.
+func dispatchFailed(status int) bool {
+	return status == http.StatusBadGateway ||
+		status == http.StatusServiceUnavailable ||
+		status == http.StatusGatewayTimeout
+}
+
+// statusRecorder captures the status code written by the dispatch handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+// Unwrap allows http.ResponseController to reach the flusher of the wrapped writer.
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
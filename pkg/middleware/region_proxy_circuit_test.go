@@ -0,0 +1,238 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	. "github.com/onsi/gomega"
+	"github.com/openshift-online/ocm-sdk-go/logging"
+
+	ocmerrors "github.com/openshift-online/ocm-service-common/pkg/error"
+)
+
+// statusDispatchFunc returns a dispatch handler answering every dispatched request with the
+// status code currently stored in status, and counting the dispatched requests.
+func statusDispatchFunc(status *atomic.Int32, dispatched *atomic.Int32) dispatchHandlerFunc {
+	return func(ctx context.Context, logger logging.Logger, w http.ResponseWriter, r *http.Request,
+		next http.Handler, rhRegionId string) error {
+		if rhRegionId == "" {
+			next.ServeHTTP(w, r)
+			return nil
+		}
+		dispatched.Add(1)
+		w.WriteHeader(int(status.Load()))
+		return nil
+	}
+}
+
+func newCircuitProxy(config CircuitBreakerConfig, status *atomic.Int32, dispatched *atomic.Int32) *RegionProxy {
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(statusDispatchFunc(status, dispatched)),
+		WithCircuitBreaker(config),
+	)
+	middleware.updateCache(context.Background(), APRhRegionId, clusterIds)
+	return middleware
+}
+
+func serveOnce(handler http.Handler) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	return recorder
+}
+
+func TestCircuitOpensAfterConsecutiveFailures(t *testing.T) {
+	RegisterTestingT(t)
+	status, dispatched := &atomic.Int32{}, &atomic.Int32{}
+	status.Store(http.StatusBadGateway)
+	middleware := newCircuitProxy(CircuitBreakerConfig{FailureThreshold: 3, OpenTimeout: time.Hour}, status, dispatched)
+	router := middleware.Handler(nextHandler)
+
+	for i := 0; i < 3; i++ {
+		Expect(serveOnce(router).Code).To(Equal(http.StatusBadGateway))
+	}
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitOpen))
+
+	recorder := serveOnce(router)
+	Expect(dispatched.Load()).To(Equal(int32(3)))
+	Expect(recorder.Code).To(Equal(http.StatusServiceUnavailable))
+	Expect(recorder.Header().Get("Retry-After")).NotTo(BeEmpty())
+	body := ocmerrors.Error{}
+	Expect(json.Unmarshal(recorder.Body.Bytes(), &body)).To(Succeed())
+	Expect(body.Kind).To(Equal("Error"))
+	Expect(body.ID).To(Equal("503"))
+	Expect(body.Code).To(Equal("REGION-PROXY-503"))
+}
+
+func TestCircuitSuccessResetsFailures(t *testing.T) {
+	RegisterTestingT(t)
+	status, dispatched := &atomic.Int32{}, &atomic.Int32{}
+	middleware := newCircuitProxy(CircuitBreakerConfig{FailureThreshold: 2}, status, dispatched)
+	router := middleware.Handler(nextHandler)
+
+	for _, code := range []int{http.StatusGatewayTimeout, http.StatusOK, http.StatusGatewayTimeout,
+		http.StatusInternalServerError} {
+		status.Store(int32(code))
+		serveOnce(router)
+	}
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitClosed))
+}
+
+func TestCircuitHalfOpenProbe(t *testing.T) {
+	RegisterTestingT(t)
+	status, dispatched := &atomic.Int32{}, &atomic.Int32{}
+	status.Store(http.StatusServiceUnavailable)
+	middleware := newCircuitProxy(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, status, dispatched)
+	now := time.Now()
+	middleware.circuits.now = func() time.Time { return now }
+	router := middleware.Handler(nextHandler)
+
+	serveOnce(router)
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitOpen))
+
+	// the probe fails, the circuit opens again
+	now = now.Add(time.Minute)
+	Expect(serveOnce(router).Code).To(Equal(http.StatusServiceUnavailable))
+	Expect(dispatched.Load()).To(Equal(int32(2)))
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitOpen))
+
+	// the probe succeeds, the circuit closes
+	now = now.Add(time.Minute)
+	status.Store(http.StatusOK)
+	Expect(serveOnce(router).Code).To(Equal(http.StatusOK))
+	Expect(dispatched.Load()).To(Equal(int32(3)))
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitClosed))
+}
+
+func TestCircuitHalfOpenProbePanics(t *testing.T) {
+	RegisterTestingT(t)
+	status, dispatched := &atomic.Int32{}, &atomic.Int32{}
+	status.Store(http.StatusServiceUnavailable)
+	middleware := newCircuitProxy(CircuitBreakerConfig{FailureThreshold: 1, OpenTimeout: time.Minute}, status, dispatched)
+	now := time.Now()
+	middleware.circuits.now = func() time.Time { return now }
+	router := middleware.Handler(nextHandler)
+
+	serveOnce(router)
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitOpen))
+
+	// the probe panics, it counts as a failure
+	now = now.Add(time.Minute)
+	dispatch := middleware.dispatchHandler
+	middleware.dispatchHandler = func(ctx context.Context, logger logging.Logger, w http.ResponseWriter,
+		r *http.Request, next http.Handler, rhRegionId string) error {
+		panic("boom")
+	}
+	Expect(func() { serveOnce(router) }).To(PanicWith("boom"))
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitOpen))
+
+	// and the next probe is let through
+	now = now.Add(time.Minute)
+	middleware.dispatchHandler = dispatch
+	status.Store(http.StatusOK)
+	Expect(serveOnce(router).Code).To(Equal(http.StatusOK))
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitClosed))
+}
+
+func TestCircuitLatencyThreshold(t *testing.T) {
+	RegisterTestingT(t)
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(func(ctx context.Context, logger logging.Logger, w http.ResponseWriter, r *http.Request,
+			next http.Handler, rhRegionId string) error {
+			time.Sleep(20 * time.Millisecond)
+			return nil
+		}),
+		WithCircuitBreaker(CircuitBreakerConfig{FailureThreshold: 1, LatencyThreshold: time.Millisecond}),
+	)
+	middleware.updateCache(context.Background(), APRhRegionId, clusterIds)
+
+	serveOnce(middleware.Handler(nextHandler))
+	Expect(middleware.CircuitState(APRhRegionId)).To(Equal(CircuitOpen))
+}
+
+func TestCircuitServeLocallyFallback(t *testing.T) {
+	RegisterTestingT(t)
+	calledNext = false
+	status, dispatched := &atomic.Int32{}, &atomic.Int32{}
+	status.Store(http.StatusBadGateway)
+	middleware := newCircuitProxy(CircuitBreakerConfig{FailureThreshold: 1, Fallback: ServeLocally}, status, dispatched)
+	router := middleware.Handler(nextHandler)
+
+	serveOnce(router)
+	Expect(calledNext).To(BeFalse())
+	Expect(serveOnce(router).Code).To(Equal(http.StatusOK))
+	Expect(calledNext).To(BeTrue())
+	Expect(dispatched.Load()).To(Equal(int32(1)))
+}
+
+func TestCircuitHealthCheck(t *testing.T) {
+	RegisterTestingT(t)
+	healthy := &atomic.Bool{}
+	regional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/healthz" && !healthy.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+	}))
+	defer regional.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	middleware := NewRegionProxy(
+		ctx,
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithRegionURLHandler(func(rhRegionId string) (*url.URL, error) {
+			return url.Parse(regional.URL)
+		}),
+		WithCircuitBreaker(CircuitBreakerConfig{
+			OpenTimeout:         time.Hour,
+			HealthCheckPath:     "/healthz",
+			HealthCheckInterval: 10 * time.Millisecond,
+		}),
+	)
+	middleware.updateCache(context.Background(), APRhRegionId, clusterIds)
+
+	// the region becomes known once a request was dispatched to it
+	serveOnce(middleware.Handler(nextHandler))
+	Eventually(func() CircuitState { return middleware.CircuitState(APRhRegionId) }).Should(Equal(CircuitOpen))
+
+	healthy.Store(true)
+	Eventually(func() CircuitState { return middleware.CircuitState(APRhRegionId) }).Should(Equal(CircuitHalfOpen))
+}
+
+func TestCircuitHealthCheckFailureThreshold(t *testing.T) {
+	RegisterTestingT(t)
+	circuits := newCircuitBreakers(CircuitBreakerConfig{FailureThreshold: 3})
+
+	// a healthy check resets the failures
+	circuits.recordHealth(APRhRegionId, false)
+	circuits.recordHealth(APRhRegionId, false)
+	circuits.recordHealth(APRhRegionId, true)
+	circuits.recordHealth(APRhRegionId, false)
+	Expect(circuits.state(APRhRegionId)).To(Equal(CircuitClosed))
+
+	circuits.recordHealth(APRhRegionId, false)
+	Expect(circuits.state(APRhRegionId)).To(Equal(CircuitClosed))
+	circuits.recordHealth(APRhRegionId, false)
+	Expect(circuits.state(APRhRegionId)).To(Equal(CircuitOpen))
+
+	// a failed check doesn't release the probe of a half-open circuit
+	circuits.recordHealth(APRhRegionId, true)
+	allowed, _ := circuits.allow(APRhRegionId)
+	Expect(allowed).To(BeTrue())
+	circuits.recordHealth(APRhRegionId, false)
+	Expect(circuits.state(APRhRegionId)).To(Equal(CircuitHalfOpen))
+	allowed, _ = circuits.allow(APRhRegionId)
+	Expect(allowed).To(BeFalse())
+}
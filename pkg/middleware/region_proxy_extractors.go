@@ -0,0 +1,178 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+	"github.com/openshift-online/ocm-sdk-go/logging"
+)
+
+const (
+	// defaultMaxBodyBytes is the largest request body ClusterIdsFromJSONBody reads looking for ids.
+	defaultMaxBodyBytes = 1 << 20
+
+	clusterIdKey         = "cluster_id"
+	externalClusterIdKey = "external_cluster_id"
+)
+
+// ClusterIdsExtractor retrieves the id and/or external id of the cluster a request is about. It
+// returns empty ids when the request isn't about a cluster.
+type ClusterIdsExtractor func(context.Context, logging.Logger, *http.Request) ClusterIds
+
+// defaultClusterPathTemplates are the OCM paths handled by the default extractor.
+var defaultClusterPathTemplates = []string{
+	"/api/clusters_mgmt/v1/clusters/{id}",
+}
+
+// DefaultClusterIdsExtractor is used when the region proxy is created without
+// WithGetClusterIdsHandler, it finds the cluster in the clusters_mgmt cluster paths or in the
+// cluster_id and external_cluster_id query parameters.
+func DefaultClusterIdsExtractor() ClusterIdsExtractor {
+	return FirstClusterIds(
+		ClusterIdsFromPathTemplates(defaultClusterPathTemplates...),
+		ClusterIdsFromQuery(clusterIdKey, externalClusterIdKey),
+	)
+}
+
+// FirstClusterIds composes extractors, returning the ids found by the first one that finds any.
+func FirstClusterIds(extractors ...ClusterIdsExtractor) ClusterIdsExtractor {
+	return func(ctx context.Context, logger logging.Logger, r *http.Request) ClusterIds {
+		for _, extractor := range extractors {
+			ids := extractor(ctx, logger, r)
+			if ids.Id != "" || ids.ExternalId != "" {
+				return ids
+			}
+		}
+		return ClusterIds{}
+	}
+}
+
+// ClusterIdsFromMuxVars reads the ids from the gorilla/mux route variables of the request. Either
+// name may be empty. It only finds ids when the region proxy runs after the route was matched,
+// e.g. when it is added with Router.Use.
+func ClusterIdsFromMuxVars(idVar, externalIdVar string) ClusterIdsExtractor {
+	return func(ctx context.Context, logger logging.Logger, r *http.Request) ClusterIds {
+		vars := mux.Vars(r)
+		return ClusterIds{
+			Id:         lookupNonEmpty(vars, idVar),
+			ExternalId: lookupNonEmpty(vars, externalIdVar),
+		}
+	}
+}
+
+// ClusterIdsFromPathTemplates matches the request path against templates like
+// `/api/clusters_mgmt/v1/clusters/{id}`. The `{id}` and `{cluster_id}` variables are read as the
+// cluster id, `{external_id}` and `{external_cluster_id}` as the external id, any other variable
+// matches any value. Templates match path prefixes, so the template above also finds the cluster
+// of `/api/clusters_mgmt/v1/clusters/123/addons`. The first matching template wins.
+func ClusterIdsFromPathTemplates(templates ...string) ClusterIdsExtractor {
+	return func(ctx context.Context, logger logging.Logger, r *http.Request) ClusterIds {
+		pathParts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+		for _, template := range templates {
+			if ids, matched := matchClusterPathTemplate(pathParts, template); matched {
+				return ids
+			}
+		}
+		return ClusterIds{}
+	}
+}
+
+// ClusterIdsFromQuery reads the ids from the query parameters of the request. Either name may be
+// empty.
+func ClusterIdsFromQuery(idParam, externalIdParam string) ClusterIdsExtractor {
+	return func(ctx context.Context, logger logging.Logger, r *http.Request) ClusterIds {
+		query := r.URL.Query()
+		ids := ClusterIds{}
+		if idParam != "" {
+			ids.Id = query.Get(idParam)
+		}
+		if externalIdParam != "" {
+			ids.ExternalId = query.Get(externalIdParam)
+		}
+		return ids
+	}
+}
+
+// ClusterIdsFromJSONBody reads the `cluster_id` and `external_cluster_id` top level fields of JSON
+// request bodies. At most maxBytes of the body are read, a zero value means 1MiB, and the body is
+// restored so that the next handler, or the dispatched request, can read it again.
+func ClusterIdsFromJSONBody(maxBytes int64) ClusterIdsExtractor {
+	if maxBytes <= 0 {
+		maxBytes = defaultMaxBodyBytes
+	}
+	return func(ctx context.Context, logger logging.Logger, r *http.Request) ClusterIds {
+		if r.Body == nil || r.Body == http.NoBody || !isJSONRequest(r) {
+			return ClusterIds{}
+		}
+		read, err := io.ReadAll(io.LimitReader(r.Body, maxBytes))
+		r.Body = &restoredBody{
+			Reader: io.MultiReader(bytes.NewReader(read), r.Body),
+			Closer: r.Body,
+		}
+		if err != nil {
+			logger.Warn(ctx, "Failed to read request body looking for cluster ids: %v", err)
+			return ClusterIds{}
+		}
+
+		body := struct {
+			ClusterId         string `json:"cluster_id"`
+			ExternalClusterId string `json:"external_cluster_id"`
+		}{}
+		// a body larger than maxBytes is truncated and fails to decode, it's ignored
+		if err := json.Unmarshal(read, &body); err != nil {
+			return ClusterIds{}
+		}
+		return ClusterIds{Id: body.ClusterId, ExternalId: body.ExternalClusterId}
+	}
+}
+
+func matchClusterPathTemplate(pathParts []string, template string) (ClusterIds, bool) {
+	ids := ClusterIds{}
+	templateParts := strings.Split(strings.Trim(template, "/"), "/")
+	if len(pathParts) < len(templateParts) {
+		return ids, false
+	}
+	for i, templatePart := range templateParts {
+		if !strings.HasPrefix(templatePart, "{") || !strings.HasSuffix(templatePart, "}") {
+			if pathParts[i] != templatePart {
+				return ClusterIds{}, false
+			}
+			continue
+		}
+		if pathParts[i] == "" {
+			return ClusterIds{}, false
+		}
+		switch strings.Trim(templatePart, "{}") {
+		case "id", clusterIdKey:
+			ids.Id = pathParts[i]
+		case "external_id", externalClusterIdKey:
+			ids.ExternalId = pathParts[i]
+		}
+	}
+	return ids, true
+}
+
+func isJSONRequest(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"))
+}
+
+func lookupNonEmpty(values map[string]string, key string) string {
+	if key == "" {
+		return ""
+	}
+	return values[key]
+}
+
+// restoredBody replays the bytes already read from a request body before the rest of it, and
+// closes the original body.
+type restoredBody struct {
+	io.Reader
+	io.Closer
+}
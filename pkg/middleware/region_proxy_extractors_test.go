@@ -0,0 +1,126 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	. "github.com/onsi/gomega"
+)
+
+func extract(extractor ClusterIdsExtractor, r *http.Request) ClusterIds {
+	return extractor(context.Background(), nil, r)
+}
+
+func TestClusterIdsFromPathTemplates(t *testing.T) {
+	RegisterTestingT(t)
+	extractor := ClusterIdsFromPathTemplates(
+		"/api/clusters_mgmt/v1/clusters/{id}",
+		"/api/service_logs/v1/clusters/{external_id}/cluster_logs",
+		"/api/accounts_mgmt/v1/organizations/{org_id}/clusters/{cluster_id}",
+	)
+
+	cases := map[string]ClusterIds{
+		"/api/clusters_mgmt/v1/clusters/123":                      {Id: "123"},
+		"/api/clusters_mgmt/v1/clusters/123/":                     {Id: "123"},
+		"/api/clusters_mgmt/v1/clusters/123/addons/abc":           {Id: "123"},
+		"/api/service_logs/v1/clusters/ext-1/cluster_logs":        {ExternalId: "ext-1"},
+		"/api/accounts_mgmt/v1/organizations/org/clusters/456":    {Id: "456"},
+		"/api/clusters_mgmt/v1/clusters":                          {},
+		"/api/clusters_mgmt/v1/clusters//addons":                  {},
+		"/api/service_logs/v1/clusters/ext-1/other":               {},
+		"/api/accounts_mgmt/v1/organizations/org/subscriptions/1": {},
+	}
+	for path, expected := range cases {
+		Expect(extract(extractor, httptest.NewRequest(http.MethodGet, path, nil))).To(Equal(expected), path)
+	}
+}
+
+func TestClusterIdsFromQuery(t *testing.T) {
+	RegisterTestingT(t)
+	request := httptest.NewRequest(http.MethodGet, "/?cluster_id=123&external_cluster_id=ext-1", nil)
+	Expect(extract(ClusterIdsFromQuery("cluster_id", "external_cluster_id"), request)).
+		To(Equal(ClusterIds{Id: "123", ExternalId: "ext-1"}))
+	Expect(extract(ClusterIdsFromQuery("", "external_cluster_id"), request)).
+		To(Equal(ClusterIds{ExternalId: "ext-1"}))
+}
+
+func TestClusterIdsFromMuxVars(t *testing.T) {
+	RegisterTestingT(t)
+	request := mux.SetURLVars(httptest.NewRequest(http.MethodGet, "/", nil), map[string]string{"cluster": "123"})
+	Expect(extract(ClusterIdsFromMuxVars("cluster", "external"), request)).To(Equal(ClusterIds{Id: "123"}))
+	Expect(extract(ClusterIdsFromMuxVars("", ""), request)).To(Equal(ClusterIds{}))
+}
+
+func TestClusterIdsFromJSONBody(t *testing.T) {
+	RegisterTestingT(t)
+	body := `{"cluster_id":"123","external_cluster_id":"ext-1","summary":"hello"}`
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json; charset=utf-8")
+
+	Expect(extract(ClusterIdsFromJSONBody(0), request)).To(Equal(ClusterIds{Id: "123", ExternalId: "ext-1"}))
+	restored, err := io.ReadAll(request.Body)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(restored)).To(Equal(body))
+}
+
+func TestClusterIdsFromJSONBodyLimits(t *testing.T) {
+	RegisterTestingT(t)
+	body := `{"cluster_id":"123"}`
+
+	// bodies larger than the limit are ignored but fully restored
+	request := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	Expect(extract(ClusterIdsFromJSONBody(5), request)).To(Equal(ClusterIds{}))
+	restored, err := io.ReadAll(request.Body)
+	Expect(err).NotTo(HaveOccurred())
+	Expect(string(restored)).To(Equal(body))
+
+	// non JSON bodies aren't read
+	request = httptest.NewRequest(http.MethodPost, "/", strings.NewReader(body))
+	request.Header.Set("Content-Type", "text/plain")
+	Expect(extract(ClusterIdsFromJSONBody(0), request)).To(Equal(ClusterIds{}))
+}
+
+func TestFirstClusterIds(t *testing.T) {
+	RegisterTestingT(t)
+	extractor := FirstClusterIds(
+		ClusterIdsFromPathTemplates("/clusters/{id}"),
+		ClusterIdsFromQuery("cluster_id", ""),
+	)
+	Expect(extract(extractor, httptest.NewRequest(http.MethodGet, "/clusters/1?cluster_id=2", nil))).
+		To(Equal(ClusterIds{Id: "1"}))
+	Expect(extract(extractor, httptest.NewRequest(http.MethodGet, "/other?cluster_id=2", nil))).
+		To(Equal(ClusterIds{Id: "2"}))
+	Expect(extract(extractor, httptest.NewRequest(http.MethodGet, "/other", nil))).
+		To(Equal(ClusterIds{}))
+}
+
+func TestDefaultClusterIdsExtractor(t *testing.T) {
+	RegisterTestingT(t)
+	calledNext = false
+	callDispatched = false
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithDispatchHandler(mockDispatchFunc),
+	)
+	middleware.updateCache(context.Background(), APRhRegionId, ClusterIds{Id: "123"})
+	router := middleware.Handler(nextHandler)
+
+	// no cluster in the request, served locally instead of panicking
+	request := httptest.NewRequest(http.MethodGet, "/api/clusters_mgmt/v1/versions", nil)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	Expect(calledNext).To(BeTrue())
+	Expect(callDispatched).To(BeFalse())
+
+	calledNext = false
+	request = httptest.NewRequest(http.MethodGet, "/api/clusters_mgmt/v1/clusters/123", nil)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+	Expect(calledNext).To(BeFalse())
+	Expect(callDispatched).To(BeTrue())
+}
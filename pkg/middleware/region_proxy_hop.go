@@ -0,0 +1,135 @@
+package middleware
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/pkg/errors"
+)
+
+const (
+	// RegionProxyHopHeader is stamped on every request dispatched by the region proxy, it carries
+	// the region where the request entered the system, the number of times it has been dispatched
+	// and an identifier shared by all the hops of the same request. It is only trusted on the
+	// requests of peer regions, see WithTrustedPeerHandler.
+	RegionProxyHopHeader = "X-Region-Proxy-Hop"
+
+	requestIdHeader = "X-Request-Id"
+
+	hopOriginKey    = "origin"
+	hopCountKey     = "hops"
+	hopRequestIdKey = "request_id"
+
+	// defaultMaxHops allows a request to be dispatched once, a regional instance receiving an
+	// already dispatched request will serve it or fail, but never dispatch it again.
+	defaultMaxHops = 1
+)
+
+// ErrHopLimitExceeded is returned to the error handler when a request that was already dispatched
+// by another region proxy would need to be dispatched again beyond the configured limit.
+var ErrHopLimitExceeded = errors.New("region proxy hop limit exceeded")
+
+// RegionProxyHop is the decoded value of the RegionProxyHopHeader.
+type RegionProxyHop struct {
+	OriginRegion string
+	Count        int
+	RequestId    string
+}
+
+// String returns the header representation of the hop,
+// e.g. `origin=aws.us-east-1; hops=1; request_id=2b4e...`
+func (h RegionProxyHop) String() string {
+	return fmt.Sprintf("%s=%s; %s=%d; %s=%s",
+		hopOriginKey, h.OriginRegion, hopCountKey, h.Count, hopRequestIdKey, h.RequestId)
+}
+
+// ParseRegionProxyHop decodes the value of the RegionProxyHopHeader. The second return value is
+// false when the value is empty or malformed.
+func ParseRegionProxyHop(value string) (RegionProxyHop, bool) {
+	hop := RegionProxyHop{}
+	if strings.TrimSpace(value) == "" {
+		return hop, false
+	}
+	for _, part := range strings.Split(value, ";") {
+		key, val, found := strings.Cut(strings.TrimSpace(part), "=")
+		if !found {
+			return RegionProxyHop{}, false
+		}
+		switch strings.TrimSpace(key) {
+		case hopOriginKey:
+			hop.OriginRegion = strings.TrimSpace(val)
+		case hopCountKey:
+			count, err := strconv.Atoi(strings.TrimSpace(val))
+			if err != nil || count < 0 {
+				return RegionProxyHop{}, false
+			}
+			hop.Count = count
+		case hopRequestIdKey:
+			hop.RequestId = strings.TrimSpace(val)
+		}
+	}
+	return hop, true
+}
+
+// nextHop computes the hop to stamp on a request about to be dispatched. It returns
+// ErrHopLimitExceeded when the request already went through maxHops dispatches. The hop header of
+// requests that don't come from a trusted peer is ignored, the request entered the system here.
+func nextHop(r *http.Request, localRegionId string, maxHops int, trusted bool) (RegionProxyHop, error) {
+	hop, found := RegionProxyHop{}, false
+	if trusted {
+		hop, found = ParseRegionProxyHop(r.Header.Get(RegionProxyHopHeader))
+	}
+	if found && hop.Count >= maxHops {
+		return hop, errors.Wrapf(ErrHopLimitExceeded,
+			"request %s from region '%s' already dispatched %d time(s)", hop.RequestId, hop.OriginRegion, hop.Count)
+	}
+	if !found {
+		hop.OriginRegion = localRegionId
+	}
+	if hop.RequestId == "" {
+		hop.RequestId = r.Header.Get(requestIdHeader)
+	}
+	if hop.RequestId == "" {
+		hop.RequestId = uuid.NewString()
+	}
+	hop.Count++
+	return hop, nil
+}
+
+// stampDispatchHeaders adds the hop header and the standard forwarding headers to a request
+// that is about to be dispatched to another region. The X-Forwarded-For header isn't set here
+// because httputil.ReverseProxy already appends the client address to it.
+func stampDispatchHeaders(r *http.Request, hop RegionProxyHop) {
+	r.Header.Set(RegionProxyHopHeader, hop.String())
+	if hop.RequestId != "" && r.Header.Get(requestIdHeader) == "" {
+		r.Header.Set(requestIdHeader, hop.RequestId)
+	}
+
+	proto := "http"
+	if r.TLS != nil {
+		proto = "https"
+	}
+	// Keep the values set by the first proxy, they describe what the client actually used.
+	if r.Header.Get("X-Forwarded-Host") == "" {
+		r.Header.Set("X-Forwarded-Host", r.Host)
+	}
+	if r.Header.Get("X-Forwarded-Proto") == "" {
+		r.Header.Set("X-Forwarded-Proto", proto)
+	}
+
+	element := fmt.Sprintf("host=%q;proto=%s", r.Host, proto)
+	if clientIP, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		if strings.Contains(clientIP, ":") {
+			clientIP = fmt.Sprintf("[%s]", clientIP)
+		}
+		element = fmt.Sprintf("for=%q;%s", clientIP, element)
+	}
+	if prior := r.Header.Get("Forwarded"); prior != "" {
+		element = prior + ", " + element
+	}
+	r.Header.Set("Forwarded", element)
+}
@@ -0,0 +1,205 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+const (
+	regionA = "aws.region-a"
+	regionB = "aws.region-b"
+)
+
+// pingPongRegions starts two regional servers whose caches both claim that clusterId lives in the
+// other region, so each of them keeps dispatching the request to the other one.
+type pingPongRegions struct {
+	lock       sync.Mutex
+	servers    map[string]*httptest.Server
+	hopHeaders map[string][]string
+	calledNext map[string]bool
+}
+
+func newPingPongRegions(t *testing.T, maxHops int) *pingPongRegions {
+	regions := &pingPongRegions{
+		servers:    map[string]*httptest.Server{},
+		hopHeaders: map[string][]string{},
+		calledNext: map[string]bool{},
+	}
+	regionURL := func(rhRegionId string) (*url.URL, error) {
+		return url.Parse(regions.servers[rhRegionId].URL)
+	}
+	for local, remote := range map[string]string{regionA: regionB, regionB: regionA} {
+		local := local
+		proxy := NewRegionProxy(
+			context.Background(),
+			WithSDKConnection(connection),
+			WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+			WithLocalRegionId(local),
+			WithMaxHops(maxHops),
+			WithRegionURLHandler(regionURL),
+		)
+		proxy.updateCache(context.Background(), remote, clusterIds)
+		next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			regions.lock.Lock()
+			defer regions.lock.Unlock()
+			regions.calledNext[local] = true
+		})
+		handler := proxy.Handler(next)
+		regions.servers[local] = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			regions.lock.Lock()
+			regions.hopHeaders[local] = append(regions.hopHeaders[local], r.Header.Get(RegionProxyHopHeader))
+			regions.lock.Unlock()
+			handler.ServeHTTP(w, r)
+		}))
+		t.Cleanup(regions.servers[local].Close)
+	}
+	return regions
+}
+
+func TestDispatchedRequestIsNotDispatchedAgain(t *testing.T) {
+	RegisterTestingT(t)
+	regions := newPingPongRegions(t, 1)
+
+	request, err := http.NewRequest(http.MethodGet, regions.servers[regionA].URL+"/api/clusters_mgmt/v1/clusters", nil)
+	Expect(err).NotTo(HaveOccurred())
+	response, err := http.DefaultClient.Do(request)
+	Expect(err).NotTo(HaveOccurred())
+	defer response.Body.Close()
+
+	Expect(response.StatusCode).To(Equal(http.StatusLoopDetected))
+	Expect(regions.hopHeaders[regionA]).To(Equal([]string{""}))
+	Expect(regions.hopHeaders[regionB]).To(HaveLen(1))
+	hop, found := ParseRegionProxyHop(regions.hopHeaders[regionB][0])
+	Expect(found).To(BeTrue())
+	Expect(hop.OriginRegion).To(Equal(regionA))
+	Expect(hop.Count).To(Equal(1))
+	Expect(hop.RequestId).NotTo(BeEmpty())
+	Expect(regions.calledNext).To(BeEmpty())
+}
+
+func TestHopLimitIsConfigurable(t *testing.T) {
+	RegisterTestingT(t)
+	regions := newPingPongRegions(t, 3)
+
+	request, err := http.NewRequest(http.MethodGet, regions.servers[regionA].URL+"/", nil)
+	Expect(err).NotTo(HaveOccurred())
+	request.Header.Set(requestIdHeader, "my-request-id")
+	response, err := http.DefaultClient.Do(request)
+	Expect(err).NotTo(HaveOccurred())
+	defer response.Body.Close()
+
+	// a -> b -> a -> b, refused by b on the 4th dispatch
+	Expect(response.StatusCode).To(Equal(http.StatusLoopDetected))
+	Expect(regions.hopHeaders[regionA]).To(HaveLen(2))
+	Expect(regions.hopHeaders[regionB]).To(HaveLen(2))
+	last, _ := ParseRegionProxyHop(regions.hopHeaders[regionB][1])
+	Expect(last).To(Equal(RegionProxyHop{OriginRegion: regionA, Count: 3, RequestId: "my-request-id"}))
+}
+
+func TestDispatchStampsForwardedHeaders(t *testing.T) {
+	RegisterTestingT(t)
+	var received http.Header
+	regional := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = r.Header.Clone()
+	}))
+	defer regional.Close()
+
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithLocalRegionId(regionA),
+		WithRegionURLHandler(func(rhRegionId string) (*url.URL, error) {
+			return url.Parse(regional.URL)
+		}),
+	)
+	middleware.updateCache(context.Background(), regionB, clusterIds)
+
+	request := httptest.NewRequest(http.MethodGet, "http://api.openshift.com/", nil)
+	request.RemoteAddr = "10.0.0.1:4321"
+	recorder := httptest.NewRecorder()
+	middleware.Handler(nextHandler).ServeHTTP(recorder, request)
+
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	Expect(received.Get("X-Forwarded-Host")).To(Equal("api.openshift.com"))
+	Expect(received.Get("X-Forwarded-Proto")).To(Equal("http"))
+	Expect(received.Get("X-Forwarded-For")).To(Equal("10.0.0.1"))
+	Expect(received.Get("Forwarded")).To(Equal(`for="10.0.0.1";host="api.openshift.com";proto=http`))
+	Expect(received.Get(RegionProxyHopHeader)).To(HavePrefix("origin=aws.region-a; hops=1; request_id="))
+}
+
+func TestRequestForLocalRegionIsNotDispatched(t *testing.T) {
+	RegisterTestingT(t)
+	calledNext = false
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithLocalRegionId(regionA),
+		WithDispatchHandler(mockDispatchFunc),
+	)
+	middleware.updateCache(context.Background(), regionA, clusterIds)
+	local := testutil.ToFloat64(requestsServedLocally.WithLabelValues(regionA))
+
+	recorder := httptest.NewRecorder()
+	middleware.Handler(nextHandler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	Expect(calledNext).To(BeTrue())
+	Expect(testutil.ToFloat64(requestsServedLocally.WithLabelValues(regionA))).To(Equal(local + 1))
+}
+
+func TestHopHeaderOfUntrustedRequestsIsIgnored(t *testing.T) {
+	RegisterTestingT(t)
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithLocalRegionId(regionA),
+		WithDispatchHandler(mockDispatchFunc),
+		WithTrustedPeerHandler(func(r *http.Request) bool {
+			return r.Header.Get("X-Peer") != ""
+		}),
+	)
+	middleware.updateCache(context.Background(), regionB, clusterIds)
+	router := middleware.Handler(nextHandler)
+	forged := RegionProxyHop{OriginRegion: "forged", Count: defaultMaxHops, RequestId: "id"}.String()
+
+	// the forged hop of a client is replaced
+	callDispatched = false
+	request := httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RegionProxyHopHeader, forged)
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	Expect(callDispatched).To(BeTrue())
+
+	// the same hop from a peer is refused
+	callDispatched = false
+	request = httptest.NewRequest(http.MethodGet, "/", nil)
+	request.Header.Set(RegionProxyHopHeader, forged)
+	request.Header.Set("X-Peer", "true")
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, request)
+	Expect(recorder.Code).To(Equal(http.StatusLoopDetected))
+	Expect(callDispatched).To(BeFalse())
+}
+
+func TestParseRegionProxyHop(t *testing.T) {
+	RegisterTestingT(t)
+	hop := RegionProxyHop{OriginRegion: regionA, Count: 2, RequestId: "abc"}
+	parsed, found := ParseRegionProxyHop(hop.String())
+	Expect(found).To(BeTrue())
+	Expect(parsed).To(Equal(hop))
+
+	for _, value := range []string{"", "garbage", "hops=-1", "hops=abc"} {
+		_, found = ParseRegionProxyHop(value)
+		Expect(found).To(BeFalse(), value)
+	}
+}
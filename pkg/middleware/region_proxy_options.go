@@ -1,9 +1,9 @@
 package middleware
 
 import (
+	"net/http"
 	"time"
 
-	"github.com/hashicorp/golang-lru/v2/expirable"
 	sdk "github.com/openshift-online/ocm-sdk-go"
 	"github.com/openshift-online/ocm-sdk-go/logging"
 )
@@ -48,6 +48,67 @@ func WithErrorHandler(fn errorHandlerFunc) RegionProxyMiddwareOption {
 
 func WithClusterCache(size int, expireTime time.Duration) RegionProxyMiddwareOption {
 	return func(middleware *RegionProxy) {
-		middleware.clusterCache = expirable.NewLRU[string, string](size, nil, expireTime)
+		middleware.cacheSize = size
+		middleware.cacheTTL = expireTime
+	}
+}
+
+// WithRegionCache replaces the default in memory cache of cluster regions, for example with one
+// backed by a store shared by all the replicas of the service. The size set with WithClusterCache
+// only applies to the default cache, the expiration times are honored by any cache.
+func WithRegionCache(cache RegionCache) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.clusterCache = cache
+	}
+}
+
+// WithNegativeCache sets how long clusters that don't exist in AMS, and failed AMS lookups, are
+// cached. A zero duration disables caching of those results.
+func WithNegativeCache(notFoundExpireTime, errorExpireTime time.Duration) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.notFoundCacheTTL = notFoundExpireTime
+		middleware.errorCacheTTL = errorExpireTime
+	}
+}
+
+// WithRegionURLHandler overrides how the API URL of a region is computed from its rh_region_id,
+// it is used by the default dispatch handler.
+func WithRegionURLHandler(fn regionURLHandlerFunc) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.regionURLHandler = fn
+	}
+}
+
+// WithLocalRegionId sets the rh_region_id served by this instance. Requests for clusters in this
+// region are never dispatched, and it is stamped as the origin of the requests dispatched elsewhere.
+func WithLocalRegionId(rhRegionId string) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.localRegionId = rhRegionId
+	}
+}
+
+// WithMaxHops sets how many times a request may be dispatched between regions before it is
+// refused with ErrHopLimitExceeded.
+func WithMaxHops(maxHops int) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.maxHops = maxHops
+	}
+}
+
+// WithTrustedPeerHandler sets the function telling whether a request comes from the region proxy of
+// a peer region, e.g. from its client certificate or the service account of its token. The
+// RegionProxyHopHeader of the other requests is ignored, so that clients can neither forge their
+// origin region nor exhaust the hop limit. Without it the header of every request is trusted, and
+// the ingress must strip it from the requests of external clients.
+func WithTrustedPeerHandler(fn func(r *http.Request) bool) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.trustedPeerHandler = fn
+	}
+}
+
+// WithCircuitBreaker enables per destination region circuit breaking, see CircuitBreakerConfig.
+func WithCircuitBreaker(config CircuitBreakerConfig) RegionProxyMiddwareOption {
+	return func(middleware *RegionProxy) {
+		middleware.circuits = newCircuitBreakers(config)
 	}
 }
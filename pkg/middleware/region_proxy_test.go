@@ -18,6 +18,9 @@ import (
 	sdk "github.com/openshift-online/ocm-sdk-go"
 	"github.com/openshift-online/ocm-sdk-go/logging"
 	. "github.com/openshift-online/ocm-sdk-go/testing"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
 )
 
 const (
@@ -276,3 +279,132 @@ func mockDispatchFunc(ctx context.Context, logger logging.Logger, w http.Respons
 	}
 	return nil
 }
+
+func TestLookupErrorIsNotCached(t *testing.T) {
+	RegisterTestingT(t)
+	calledNext = false
+	callDispatched = false
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(mockDispatchFunc),
+	)
+	mockAMSServer.AppendHandlers(
+		RespondWithJSON(http.StatusBadRequest, `{"kind":"Error","id":"400","reason":"boom"}`),
+		mockResponseFromAMS(true, APRhRegionId),
+	)
+	lookupErrors := histogramSampleCount(regionLookupDuration.WithLabelValues(lookupResultError))
+	router := middleware.Handler(nextHandler)
+
+	// AMS fails, the error is returned and not cached as a local cluster
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(recorder.Code).To(Equal(http.StatusInternalServerError))
+	Expect(calledNext).To(BeFalse())
+	Expect(histogramSampleCount(regionLookupDuration.WithLabelValues(lookupResultError))).To(Equal(lookupErrors + 1))
+
+	// AMS is back, the request is dispatched
+	recorder = httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	Expect(calledNext).To(BeFalse())
+	Expect(callDispatched).To(BeTrue())
+}
+
+func TestNegativeCacheExpires(t *testing.T) {
+	RegisterTestingT(t)
+	calledNext = false
+	callDispatched = false
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(mockDispatchFunc),
+		WithNegativeCache(50*time.Millisecond, 0),
+	)
+	mockAMSServer.AppendHandlers(
+		mockResponseFromAMS(false, ""),
+		mockResponseFromAMS(true, APRhRegionId),
+	)
+	router := middleware.Handler(nextHandler)
+	negativeHits := testutil.ToFloat64(cacheLookups.WithLabelValues(cacheResultNegativeHit))
+
+	// not found in AMS, served locally twice with a single AMS call
+	for i := 0; i < 2; i++ {
+		recorder := httptest.NewRecorder()
+		router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+		Expect(calledNext).To(BeTrue())
+		Expect(callDispatched).To(BeFalse())
+	}
+	Expect(testutil.ToFloat64(cacheLookups.WithLabelValues(cacheResultNegativeHit))).To(Equal(negativeHits + 1))
+
+	// once the negative entry expires AMS is asked again
+	time.Sleep(100 * time.Millisecond)
+	calledNext = false
+	recorder := httptest.NewRecorder()
+	router.ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(calledNext).To(BeFalse())
+	Expect(callDispatched).To(BeTrue())
+}
+
+func TestDispatchMetrics(t *testing.T) {
+	RegisterTestingT(t)
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(mockDispatchFunc),
+	)
+	middleware.updateCache(context.Background(), APRhRegionId, clusterIds)
+	dispatched := testutil.ToFloat64(requestsDispatched.WithLabelValues(APRhRegionId, dispatchOutcomeDispatched))
+	hits := testutil.ToFloat64(cacheLookups.WithLabelValues(cacheResultHit))
+
+	recorder := httptest.NewRecorder()
+	middleware.Handler(nextHandler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	Expect(testutil.ToFloat64(requestsDispatched.WithLabelValues(APRhRegionId, dispatchOutcomeDispatched))).
+		To(Equal(dispatched + 1))
+	Expect(testutil.ToFloat64(cacheLookups.WithLabelValues(cacheResultHit))).To(Equal(hits + 1))
+}
+
+func TestLocalMetrics(t *testing.T) {
+	RegisterTestingT(t)
+	middleware := NewRegionProxy(
+		context.Background(),
+		WithSDKConnection(connection),
+		WithGetClusterIdsHandler(mockGetClusterIdsHandler(clusterId, clusterExternalId)),
+		WithDispatchHandler(mockDispatchFunc),
+	)
+	middleware.updateCache(context.Background(), "", clusterIds)
+	local := testutil.ToFloat64(requestsServedLocally.WithLabelValues(unknownRegionLabel))
+	dispatched := counterTotal(requestsDispatched)
+
+	recorder := httptest.NewRecorder()
+	middleware.Handler(nextHandler).ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/", nil))
+	Expect(recorder.Code).To(Equal(http.StatusOK))
+	Expect(testutil.ToFloat64(requestsServedLocally.WithLabelValues(unknownRegionLabel))).To(Equal(local + 1))
+	Expect(counterTotal(requestsDispatched)).To(Equal(dispatched))
+}
+
+// counterTotal returns the sum of the counters of all the label values.
+func counterTotal(counters *prometheus.CounterVec) float64 {
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		counters.Collect(metrics)
+		close(metrics)
+	}()
+	total := 0.0
+	for metric := range metrics {
+		value := &dto.Metric{}
+		Expect(metric.Write(value)).To(Succeed())
+		total += value.GetCounter().GetValue()
+	}
+	return total
+}
+
+func histogramSampleCount(observer prometheus.Observer) uint64 {
+	metric := &dto.Metric{}
+	Expect(observer.(prometheus.Metric).Write(metric)).To(Succeed())
+	return metric.GetHistogram().GetSampleCount()
+}
@@ -0,0 +1,139 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("logger adapters", Label("logger"), func() {
+	var (
+		output          ThreadSafeBytesBuffer
+		sentryTransport *TransportMock
+		ctx             context.Context
+	)
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		sentryTransport = &TransportMock{}
+		sentryClient, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "http://whatever@example.com/1337",
+			Transport: sentryTransport,
+			Integrations: func(i []sentry.Integration) []sentry.Integration {
+				return []sentry.Integration{}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ctx = sentry.SetHubOnContext(context.Background(), sentry.NewHub(sentryClient, sentry.NewScope()))
+		globalLevel := GetLogLevel()
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			Expect(SetLogLevel(globalLevel)).To(Succeed())
+		})
+		Expect(SetLogLevel("trace")).To(Succeed())
+	})
+
+	Context("logr", func() {
+		It("maps the verbosity to levels", func() {
+			logger := NewLogr(ctx)
+			logger.Info("info")
+			logger.V(1).Info("debug")
+			logger.V(3).Info("trace")
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			Expect(lines).To(HaveLen(3))
+			Expect(lines[0]).To(ContainSubstring("\"level\":\"info\""))
+			Expect(lines[1]).To(ContainSubstring("\"level\":\"debug\""))
+			Expect(lines[2]).To(ContainSubstring("\"level\":\"trace\""))
+		})
+
+		It("reports the caller of logr", func() {
+			NewLogr(ctx).Info("info")
+			Expect(output.String()).To(ContainSubstring("\"caller\":\"pkg/ocmlogger/adapters_test.go:"))
+
+			helper := func(logger interface{ Info(string, ...interface{}) }) {
+				logger.Info("from helper")
+			}
+			output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+			SetOutput(output)
+			helper(NewLogr(ctx).WithCallDepth(1))
+			Expect(output.String()).To(ContainSubstring("\"caller\":\"pkg/ocmlogger/adapters_test.go:"))
+		})
+
+		It("writes names and values", func() {
+			NewLogr(ctx).WithName("controller").WithName("cluster").WithValues("cluster_id", "123").
+				Info("reconciling", "attempt", 2)
+
+			result := output.String()
+			Expect(result).To(ContainSubstring("\"logger\":\"controller/cluster\""))
+			Expect(result).To(ContainSubstring("\"cluster_id\":\"123\""))
+			Expect(result).To(ContainSubstring("\"attempt\":2"))
+		})
+
+		It("captures errors with sentry", func() {
+			NewLogr(ctx).Error(errors.New("boom"), "reconcile failed")
+			Expect(sentryTransport.lastEvent).NotTo(BeNil())
+			Expect(sentryTransport.lastEvent.Message).To(Equal("reconcile failed"))
+
+			frames := sentryTransport.lastEvent.Exception[0].Stacktrace.Frames
+			Expect(frames[len(frames)-1].AbsPath).To(HaveSuffix("pkg/ocmlogger/adapters_test.go"))
+		})
+	})
+
+	Context("slog", func() {
+		It("maps the levels", func() {
+			logger := NewSlogger(ctx)
+			logger.Log(ctx, slog.LevelDebug-1, "trace")
+			logger.Debug("debug")
+			logger.Info("info")
+			logger.Warn("warn")
+
+			lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+			Expect(lines).To(HaveLen(4))
+			Expect(lines[0]).To(ContainSubstring("\"level\":\"trace\""))
+			Expect(lines[1]).To(ContainSubstring("\"level\":\"debug\""))
+			Expect(lines[2]).To(ContainSubstring("\"level\":\"info\""))
+			Expect(lines[3]).To(ContainSubstring("\"level\":\"warn\""))
+		})
+
+		It("reports the caller of slog", func() {
+			logger := NewSlogger(ctx)
+			logger.Info("info")
+			logger.InfoContext(ctx, "info")
+			logger.LogAttrs(ctx, slog.LevelInfo, "info")
+
+			for _, line := range strings.Split(strings.TrimSpace(output.String()), "\n") {
+				Expect(line).To(ContainSubstring("\"caller\":\"pkg/ocmlogger/adapters_test.go:"))
+			}
+		})
+
+		It("flattens groups and attributes", func() {
+			NewSlogger(ctx).With("cluster_id", "123").WithGroup("request").
+				Info("handled", "method", "GET", slog.Group("response", "code", 200), slog.Group("", "inlined", true))
+
+			result := output.String()
+			Expect(result).To(ContainSubstring("\"cluster_id\":\"123\""))
+			Expect(result).To(ContainSubstring("\"request.method\":\"GET\""))
+			Expect(result).To(ContainSubstring("\"request.response.code\":200"))
+			Expect(result).To(ContainSubstring("\"request.inlined\":true"))
+		})
+
+		It("captures errors with sentry", func() {
+			NewSlogger(ctx).Error("call failed", "err", errors.New("boom"))
+			Expect(sentryTransport.lastEvent).NotTo(BeNil())
+			Expect(sentryTransport.lastEvent.Message).To(Equal("call failed"))
+			Expect(output.String()).To(ContainSubstring("\"error\":\"boom\""))
+
+			frames := sentryTransport.lastEvent.Exception[0].Stacktrace.Frames
+			Expect(frames[len(frames)-1].AbsPath).To(HaveSuffix("pkg/ocmlogger/adapters_test.go"))
+		})
+	})
+})
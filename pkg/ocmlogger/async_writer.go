@@ -0,0 +1,262 @@
+package ocmlogger
+
+import (
+	"context"
+	"io"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultAsyncBufferSize = 1024
+
+	// fatalFlushTimeout is how long Fatal waits for the output to be flushed before exiting.
+	fatalFlushTimeout = 5 * time.Second
+)
+
+// OverflowPolicy is what an AsyncWriter does with an entry written while its buffer is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock waits for room in the buffer, slowing down the callers like a synchronous output.
+	OverflowBlock OverflowPolicy = iota
+
+	// OverflowDropOldest drops the oldest buffered entry to make room for the new one.
+	OverflowDropOldest
+
+	// OverflowDropNewest drops the new entry.
+	OverflowDropNewest
+)
+
+// AsyncWriterOption configures the writer returned by NewAsyncWriter.
+type AsyncWriterOption func(*AsyncWriter)
+
+// WithAsyncBufferSize sets the number of entries buffered before the OverflowPolicy applies, 1024
+// by default.
+func WithAsyncBufferSize(size int) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.ring = make([][]byte, max(size, 1))
+	}
+}
+
+// WithOverflowPolicy sets what is done when the buffer is full, OverflowBlock by default.
+func WithOverflowPolicy(policy OverflowPolicy) AsyncWriterOption {
+	return func(w *AsyncWriter) {
+		w.policy = policy
+	}
+}
+
+// AsyncWriter buffers the entries in a bounded ring and writes them to its output on a background
+// goroutine, so that logging doesn't wait for slow outputs. Its output is only written by that
+// goroutine, then by one caller at a time once closed, it doesn't need to be thread safe.
+type AsyncWriter struct {
+	output io.Writer
+	policy OverflowPolicy
+
+	lock    sync.Mutex
+	notFull *sync.Cond
+	// ring holds count entries starting at head
+	ring   [][]byte
+	head   int
+	count  int
+	closed bool
+	// accepted is the number of entries buffered so far, done the number of them written or dropped
+	accepted uint64
+	done     uint64
+	// progress is closed, and replaced, whenever done changes
+	progress chan struct{}
+	pending  chan struct{}
+	stopped  chan struct{}
+	exited   chan struct{}
+
+	// closedWriteLock serializes the writes of the callers once closed
+	closedWriteLock sync.Mutex
+
+	droppedOldest atomic.Uint64
+	droppedNewest atomic.Uint64
+}
+
+var _ io.Writer = &AsyncWriter{}
+
+// NewAsyncWriter returns an AsyncWriter writing to the output, e.g. os.Stderr, to give to SetOutput.
+// Close it to stop its goroutine.
+func NewAsyncWriter(output io.Writer, opts ...AsyncWriterOption) *AsyncWriter {
+	w := &AsyncWriter{
+		output:   output,
+		ring:     make([][]byte, defaultAsyncBufferSize),
+		progress: make(chan struct{}),
+		pending:  make(chan struct{}, 1),
+		stopped:  make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+	w.notFull = sync.NewCond(&w.lock)
+	go w.run()
+	return w
+}
+
+// Write buffers a copy of the entry, it never fails. Once the writer is closed the entries are
+// written synchronously.
+func (w *AsyncWriter) Write(p []byte) (int, error) {
+	// the caller may reuse p, e.g. zerolog pools its buffers
+	entry := append([]byte(nil), p...)
+
+	w.lock.Lock()
+	for !w.closed && w.count == len(w.ring) {
+		switch w.policy {
+		case OverflowDropNewest:
+			w.lock.Unlock()
+			w.droppedNewest.Add(1)
+			return len(p), nil
+		case OverflowDropOldest:
+			w.ring[w.head] = nil
+			w.head = (w.head + 1) % len(w.ring)
+			w.count--
+			w.markDone(1)
+			w.droppedOldest.Add(1)
+		default:
+			w.notFull.Wait()
+		}
+	}
+	if w.closed {
+		w.lock.Unlock()
+		return w.writeClosed(entry)
+	}
+	w.ring[(w.head+w.count)%len(w.ring)] = entry
+	w.count++
+	w.accepted++
+	w.lock.Unlock()
+
+	select {
+	case w.pending <- struct{}{}:
+	default:
+	}
+	return len(p), nil
+}
+
+// writeClosed writes an entry once the writer is closed, after the buffered ones.
+func (w *AsyncWriter) writeClosed(entry []byte) (int, error) {
+	<-w.exited
+	w.closedWriteLock.Lock()
+	defer w.closedWriteLock.Unlock()
+	return w.output.Write(entry)
+}
+
+// Flush waits until the entries written before the call are written to the output, or the context
+// is done.
+func (w *AsyncWriter) Flush(ctx context.Context) error {
+	w.lock.Lock()
+	target := w.accepted
+	for w.done < target {
+		progress := w.progress
+		w.lock.Unlock()
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		w.lock.Lock()
+	}
+	w.lock.Unlock()
+	return nil
+}
+
+// Close writes the buffered entries and stops the background goroutine, it waits for them to be
+// written until the context is done. The entries written afterward are written synchronously.
+func (w *AsyncWriter) Close(ctx context.Context) error {
+	w.lock.Lock()
+	if !w.closed {
+		w.closed = true
+		w.notFull.Broadcast()
+		close(w.stopped)
+	}
+	w.lock.Unlock()
+	select {
+	case <-w.exited:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// DroppedOldest is the number of buffered entries dropped by OverflowDropOldest.
+func (w *AsyncWriter) DroppedOldest() uint64 {
+	return w.droppedOldest.Load()
+}
+
+// DroppedNewest is the number of entries dropped by OverflowDropNewest.
+func (w *AsyncWriter) DroppedNewest() uint64 {
+	return w.droppedNewest.Load()
+}
+
+// run writes the buffered entries until the writer is closed.
+func (w *AsyncWriter) run() {
+	defer close(w.exited)
+	for {
+		select {
+		case <-w.stopped:
+			w.writeBuffered()
+			return
+		case <-w.pending:
+			w.writeBuffered()
+		}
+	}
+}
+
+// writeBuffered writes the entries until the buffer is empty.
+func (w *AsyncWriter) writeBuffered() {
+	for {
+		w.lock.Lock()
+		if w.count == 0 {
+			w.lock.Unlock()
+			return
+		}
+		entry := w.ring[w.head]
+		w.ring[w.head] = nil
+		w.head = (w.head + 1) % len(w.ring)
+		w.count--
+		w.notFull.Signal()
+		w.lock.Unlock()
+
+		_, _ = w.output.Write(entry)
+
+		w.lock.Lock()
+		w.markDone(1)
+		w.lock.Unlock()
+	}
+}
+
+// markDone counts written or dropped entries and wakes up the flushes, w.lock must be held.
+func (w *AsyncWriter) markDone(entries uint64) {
+	w.done += entries
+	close(w.progress)
+	w.progress = make(chan struct{})
+}
+
+// flusher is implemented by outputs buffering entries, like AsyncWriter.
+type flusher interface {
+	Flush(ctx context.Context) error
+}
+
+// outputHolder holds the output given to SetOutput.
+type outputHolder struct {
+	writer io.Writer
+}
+
+var currentOutput atomic.Pointer[outputHolder]
+
+// flushOutput flushes the output given to SetOutput, if it buffers entries, before the process exits.
+func flushOutput() {
+	output := currentOutput.Load()
+	if output == nil {
+		return
+	}
+	if f, ok := output.writer.(flusher); ok {
+		ctx, cancel := context.WithTimeout(context.Background(), fatalFlushTimeout)
+		defer cancel()
+		_ = f.Flush(ctx)
+	}
+}
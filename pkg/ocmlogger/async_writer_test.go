@@ -0,0 +1,187 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// gatedWriter blocks its writes until the gate is opened.
+type gatedWriter struct {
+	gate    chan struct{}
+	lock    sync.Mutex
+	entries []string
+}
+
+func (g *gatedWriter) Write(p []byte) (int, error) {
+	<-g.gate
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	g.entries = append(g.entries, string(p))
+	return len(p), nil
+}
+
+func (g *gatedWriter) Entries() []string {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+	return append([]string{}, g.entries...)
+}
+
+var _ = Describe("AsyncWriter", Label("logger"), func() {
+	var output *gatedWriter
+
+	BeforeEach(func() {
+		output = &gatedWriter{gate: make(chan struct{})}
+	})
+
+	// fill writes the entries while the output is blocked on the first one.
+	fill := func(writer *AsyncWriter, count int) {
+		_, _ = writer.Write([]byte("blocked"))
+		Eventually(func() int {
+			writer.lock.Lock()
+			defer writer.lock.Unlock()
+			return writer.count
+		}).Should(BeZero())
+		for i := 0; i < count; i++ {
+			_, _ = writer.Write([]byte(fmt.Sprintf("entry %d", i)))
+		}
+	}
+
+	It("writes the entries in order", func() {
+		close(output.gate)
+		writer := NewAsyncWriter(output)
+		defer writer.Close(context.Background())
+
+		buffer := []byte("first")
+		_, _ = writer.Write(buffer)
+		copy(buffer, "reuse")
+		_, _ = writer.Write([]byte("second"))
+
+		Expect(writer.Flush(context.Background())).To(Succeed())
+		Expect(output.Entries()).To(Equal([]string{"first", "second"}))
+	})
+
+	It("drops the newest entries when full", func() {
+		writer := NewAsyncWriter(output, WithAsyncBufferSize(2), WithOverflowPolicy(OverflowDropNewest))
+		fill(writer, 4)
+		close(output.gate)
+
+		Expect(writer.Flush(context.Background())).To(Succeed())
+		Expect(output.Entries()).To(Equal([]string{"blocked", "entry 0", "entry 1"}))
+		Expect(writer.DroppedNewest()).To(BeEquivalentTo(2))
+		Expect(writer.DroppedOldest()).To(BeZero())
+		Expect(writer.Close(context.Background())).To(Succeed())
+	})
+
+	It("drops the oldest entries when full", func() {
+		writer := NewAsyncWriter(output, WithAsyncBufferSize(2), WithOverflowPolicy(OverflowDropOldest))
+		fill(writer, 4)
+		close(output.gate)
+
+		Expect(writer.Flush(context.Background())).To(Succeed())
+		Expect(output.Entries()).To(Equal([]string{"blocked", "entry 2", "entry 3"}))
+		Expect(writer.DroppedOldest()).To(BeEquivalentTo(2))
+		Expect(writer.Close(context.Background())).To(Succeed())
+	})
+
+	It("blocks when full", func() {
+		writer := NewAsyncWriter(output, WithAsyncBufferSize(1))
+		fill(writer, 1)
+
+		written := make(chan struct{})
+		go func() {
+			defer close(written)
+			_, _ = writer.Write([]byte("waiting"))
+		}()
+		Consistently(written, 50*time.Millisecond).ShouldNot(BeClosed())
+		close(output.gate)
+
+		Eventually(written).Should(BeClosed())
+		Expect(writer.Close(context.Background())).To(Succeed())
+		Expect(output.Entries()).To(Equal([]string{"blocked", "entry 0", "waiting"}))
+	})
+
+	It("stops flushing when the context is done", func() {
+		writer := NewAsyncWriter(output)
+		_, _ = writer.Write([]byte("blocked"))
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+		defer cancel()
+		Expect(writer.Flush(ctx)).To(MatchError(context.DeadlineExceeded))
+		close(output.gate)
+		Expect(writer.Close(context.Background())).To(Succeed())
+	})
+
+	It("writes synchronously once closed", func() {
+		close(output.gate)
+		writer := NewAsyncWriter(output)
+		Expect(writer.Close(context.Background())).To(Succeed())
+
+		_, _ = writer.Write([]byte("after close"))
+		Expect(output.Entries()).To(Equal([]string{"after close"}))
+	})
+
+	It("is flushed before fatal exits", func() {
+		close(output.gate)
+		writer := NewAsyncWriter(output)
+		SetOutput(writer)
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			Expect(writer.Close(context.Background())).To(Succeed())
+		})
+
+		NewOCMLogger(context.Background()).Warning("last words")
+		flushOutput()
+		Expect(output.Entries()).To(ConsistOf(ContainSubstring("last words")))
+	})
+
+	It("doesn't need a thread safe output", func() {
+		buffer := &bytes.Buffer{}
+		writer := NewAsyncWriter(buffer)
+		var wait sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				_, _ = writer.Write([]byte("entry\n"))
+			}()
+		}
+		wait.Wait()
+		Expect(writer.Close(context.Background())).To(Succeed())
+		Expect(bytes.Count(buffer.Bytes(), []byte("entry\n"))).To(Equal(10))
+	})
+
+	It("writes one entry at a time once closed, after the buffered ones", func() {
+		buffer := &bytes.Buffer{}
+		gated := &gatedWriter{gate: make(chan struct{})}
+		writer := NewAsyncWriter(io.MultiWriter(gated, buffer))
+		fill(writer, 3)
+
+		// close while the entries are still buffered
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		Expect(writer.Close(ctx)).To(MatchError(context.Canceled))
+		var wait sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wait.Add(1)
+			go func() {
+				defer wait.Done()
+				_, _ = writer.Write([]byte("after close"))
+			}()
+		}
+		close(gated.gate)
+		wait.Wait()
+
+		entries := gated.Entries()
+		Expect(entries).To(HaveLen(14))
+		Expect(entries[:4]).To(Equal([]string{"blocked", "entry 0", "entry 1", "entry 2"}))
+		Expect(bytes.Count(buffer.Bytes(), []byte("after close"))).To(Equal(10))
+	})
+})
@@ -0,0 +1,214 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/mattn/go-isatty"
+	"github.com/rs/zerolog"
+)
+
+// OutputFormat selects how the entries are rendered.
+type OutputFormat int32
+
+const (
+	// OutputFormatAuto renders the entries for the console when the output is a terminal, as JSON
+	// otherwise, e.g. in containers. It is the default. The output checked is the one the entries
+	// are written to, os.Stderr unless SetOutput is called, not os.Stdout: a service whose stdout
+	// is a terminal but whose logs are redirected to a file still writes JSON.
+	OutputFormatAuto OutputFormat = iota
+
+	// OutputFormatJSON renders the entries as JSON lines.
+	OutputFormatJSON
+
+	// OutputFormatConsole renders the entries for humans, for local development.
+	OutputFormatConsole
+)
+
+const (
+	OCM_LOG_FORMAT_FLAG_NAME = "log-format"
+	// OCM_LOG_FORMAT_ENV is auto, json or console, auto checks whether the log output, os.Stderr by
+	// default, is a terminal.
+	OCM_LOG_FORMAT_ENV = "OCM_LOG_FORMAT"
+
+	// consoleMessageWidth is the width the messages are padded to, so that the key/values of
+	// consecutive console entries are aligned.
+	consoleMessageWidth = 40
+
+	consoleTimeFormat = "15:04:05.000"
+
+	colorRed      = 31
+	colorCyan     = 36
+	colorDarkGray = 90
+)
+
+var outputFormatNames = map[OutputFormat]string{
+	OutputFormatAuto:    "auto",
+	OutputFormatJSON:    "json",
+	OutputFormatConsole: "console",
+}
+
+var (
+	currentOutputFormat atomic.Int32
+	outputLock          sync.Mutex
+)
+
+func (f OutputFormat) String() string {
+	if name, ok := outputFormatNames[f]; ok {
+		return name
+	}
+	return fmt.Sprintf("OutputFormat(%d)", int32(f))
+}
+
+// ParseOutputFormat converts "auto", "json" or "console" to the corresponding OutputFormat.
+func ParseOutputFormat(name string) (OutputFormat, error) {
+	for format, formatName := range outputFormatNames {
+		if strings.EqualFold(name, formatName) {
+			return format, nil
+		}
+	}
+	return OutputFormatAuto, fmt.Errorf("unknown log format '%s', one of: auto, json, console", name)
+}
+
+// SetOutputFormat - update how the entries of all loggers are rendered. The outputs of the contexts
+// of NewContextWithOutput are always JSON.
+func SetOutputFormat(format OutputFormat) {
+	currentOutputFormat.Store(int32(format))
+	applyOutput()
+}
+
+// GetOutputFormat returns the output format currently in use, as set.
+func GetOutputFormat() OutputFormat {
+	return OutputFormat(currentOutputFormat.Load())
+}
+
+// setOutputFormatName is the callback of the log format flag and environment variable.
+func setOutputFormatName(name string) error {
+	if name == "" {
+		return nil
+	}
+	format, err := ParseOutputFormat(name)
+	if err != nil {
+		return err
+	}
+	SetOutputFormat(format)
+	return nil
+}
+
+// applyOutput renders the entries of the root logger to the output of SetOutput, os.Stderr by
+// default, in the current format.
+func applyOutput() {
+	outputLock.Lock()
+	defer outputLock.Unlock()
+	var output io.Writer = os.Stderr
+	if holder := currentOutput.Load(); holder != nil {
+		output = holder.writer
+	}
+	terminal := isTerminal(output)
+	format := GetOutputFormat()
+	if format == OutputFormatConsole || (format == OutputFormatAuto && terminal) {
+		output = newConsoleWriter(output, terminal && os.Getenv("NO_COLOR") == "")
+	}
+	updateRootLogger(func(root zerolog.Logger) zerolog.Logger {
+		return root.Output(output)
+	})
+}
+
+func isTerminal(output io.Writer) bool {
+	file, ok := output.(*os.File)
+	return ok && (isatty.IsTerminal(file.Fd()) || isatty.IsCygwinTerminal(file.Fd()))
+}
+
+// newConsoleWriter renders the entries on a single line: time, colored level, short caller, padded
+// message and key=values, the legacy `Extra` ones included. The error chain and the stack follow
+// on indented lines.
+func newConsoleWriter(output io.Writer, colored bool) io.Writer {
+	noColor := !colored
+	return zerolog.ConsoleWriter{
+		Out:           output,
+		NoColor:       noColor,
+		TimeFormat:    consoleTimeFormat,
+		FieldsExclude: []string{legacyExtraFieldName, errorChainFieldName, zerolog.ErrorStackFieldName},
+		FormatCaller: func(i interface{}) string {
+			caller, _ := i.(string)
+			return colorize(shortCaller(caller), colorDarkGray, noColor)
+		},
+		FormatMessage: func(i interface{}) string {
+			if i == nil {
+				return strings.Repeat(" ", consoleMessageWidth)
+			}
+			return fmt.Sprintf("%-*s", consoleMessageWidth, i)
+		},
+		FormatExtra: func(event map[string]interface{}, buf *bytes.Buffer) error {
+			writeConsoleExtra(event, buf, noColor)
+			return nil
+		},
+	}
+}
+
+// shortCaller keeps the file name and its directory, e.g. `ocmlogger/logger.go:12`.
+func shortCaller(caller string) string {
+	parts := strings.Split(caller, "/")
+	if len(parts) > 2 {
+		parts = parts[len(parts)-2:]
+	}
+	return strings.Join(parts, "/")
+}
+
+// writeConsoleExtra writes the legacy `Extra` key/values, then the error chain and the stack.
+func writeConsoleExtra(event map[string]interface{}, buf *bytes.Buffer, noColor bool) {
+	if extra, ok := event[legacyExtraFieldName].(map[string]interface{}); ok {
+		keys := make([]string, 0, len(extra))
+		for key := range extra {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			buf.WriteByte(' ')
+			buf.WriteString(colorize(key+"=", colorCyan, noColor))
+			buf.WriteString(consoleValue(extra[key]))
+		}
+	}
+	if chain, ok := event[errorChainFieldName].([]interface{}); ok {
+		// the first error of the chain is the logged one
+		for _, link := range chain[min(1, len(chain)):] {
+			if fields, ok := link.(map[string]interface{}); ok {
+				buf.WriteString(colorize(fmt.Sprintf("\n    caused by %v: %v", fields["type"], fields["message"]),
+					colorRed, noColor))
+			}
+		}
+	}
+	if stack, ok := event[zerolog.ErrorStackFieldName].(string); ok {
+		for _, line := range strings.Split(strings.TrimSpace(stack), "\n") {
+			buf.WriteString(colorize("\n        "+strings.TrimSpace(line), colorDarkGray, noColor))
+		}
+	}
+}
+
+func consoleValue(value interface{}) string {
+	if text, ok := value.(string); ok {
+		if strings.ContainsAny(text, " \t\n\"\\") {
+			return fmt.Sprintf("%q", text)
+		}
+		return text
+	}
+	encoded, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Sprint(value)
+	}
+	return string(encoded)
+}
+
+func colorize(s string, color int, noColor bool) string {
+	if noColor {
+		return s
+	}
+	return fmt.Sprintf("\x1b[%dm%s\x1b[0m", color, s)
+}
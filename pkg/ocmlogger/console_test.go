@@ -0,0 +1,79 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pkgerrors "github.com/pkg/errors"
+)
+
+var _ = Describe("console output", Label("logger"), func() {
+	var (
+		output ThreadSafeBytesBuffer
+		ulog   OCMLogger
+	)
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		ulog = NewOCMLogger(context.Background()).CaptureSentryEvent(false)
+		DeferCleanup(func() {
+			SetOutputFormat(OutputFormatAuto)
+			SetOutput(os.Stderr)
+		})
+	})
+
+	It("writes JSON to outputs that aren't terminals by default", func() {
+		ulog.Warning("warning")
+		Expect(output.String()).To(HavePrefix("{"))
+	})
+
+	It("renders the entries for humans", func() {
+		SetOutputFormat(OutputFormatConsole)
+		ulog.Contextual().Warning("cluster created", "cluster_id", "123", "name", "my cluster")
+
+		result := output.String()
+		Expect(result).To(MatchRegexp(`^\d\d:\d\d:\d\d\.\d{3} WRN ocmlogger/console_test\.go:\d+ cluster created {25}`))
+		Expect(result).To(ContainSubstring(` cluster_id=123 name="my cluster"`))
+		Expect(result).NotTo(ContainSubstring("\x1b["))
+		Expect(result).NotTo(ContainSubstring(legacyExtraFieldName))
+	})
+
+	It("renders the key/values of every schema", func() {
+		SetOutputFormat(OutputFormatConsole)
+		SetLogSchema(LogSchemaV2)
+		DeferCleanup(SetLogSchema, LogSchemaLegacy)
+		ulog.Contextual().Warning("cluster created", "cluster_id", "123")
+
+		Expect(output.String()).To(ContainSubstring(" cluster_id=123"))
+	})
+
+	It("renders the errors on multiple lines", func() {
+		SetOutputFormat(OutputFormatConsole)
+		SetErrorDetails(&ErrorDetailsConfig{Chain: true, Stack: true})
+		DeferCleanup(func() { SetErrorDetails(nil) })
+		err := fmt.Errorf("creating cluster: %w", pkgerrors.New("quota exceeded"))
+		ulog.Contextual().Error(err, "failed")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring(`error="creating cluster: quota exceeded"`))
+		Expect(result).To(ContainSubstring("\n    caused by *errors.fundamental: quota exceeded"))
+		Expect(result).To(MatchRegexp(`\n {8}.*console_test\.go:\d+`))
+	})
+
+	It("parses the formats", func() {
+		for _, name := range []string{"auto", "json", "Console"} {
+			format, err := ParseOutputFormat(name)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(format.String()).To(BeElementOf("auto", "json", "console"))
+		}
+		_, err := ParseOutputFormat("xml")
+		Expect(err).To(HaveOccurred())
+		Expect(setOutputFormatName("json")).To(Succeed())
+		Expect(GetOutputFormat()).To(Equal(OutputFormatJSON))
+	})
+})
@@ -0,0 +1,61 @@
+package ocmlogger
+
+import (
+	"context"
+	"io"
+)
+
+type loggerContextKey struct{}
+
+type outputContextKey struct{}
+
+type unfilteredContextKey struct{}
+
+// NewContextWithLogger returns a context holding the logger, so that the functions receiving it
+// can log with the name and values bound to the logger, see FromContext.
+func NewContextWithLogger(ctx context.Context, logger OCMLogger) context.Context {
+	return context.WithValue(ctx, loggerContextKey{}, logger)
+}
+
+// FromContext returns the logger held by the context, using ctx for sentry, tracing and the extra
+// data callbacks. Without logger in the context it returns NewOCMLogger(ctx).
+func FromContext(ctx context.Context) OCMLogger {
+	if stored, ok := ctx.Value(loggerContextKey{}).(*logger); ok {
+		return stored.child(ctx)
+	}
+	if stored, ok := ctx.Value(loggerContextKey{}).(OCMLogger); ok {
+		return stored
+	}
+	return NewOCMLogger(ctx)
+}
+
+// NewContextWithOutput returns a context whose loggers write to output instead of the output of
+// SetOutput, e.g. so that parallel tests each capture their own entries, see ocmlogtest.
+func NewContextWithOutput(ctx context.Context, output io.Writer) context.Context {
+	return context.WithValue(ctx, outputContextKey{}, output)
+}
+
+// outputFromContext returns the output set with NewContextWithOutput, or nil.
+func outputFromContext(ctx context.Context) io.Writer {
+	if ctx == nil {
+		return nil
+	}
+	output, _ := ctx.Value(outputContextKey{}).(io.Writer)
+	return output
+}
+
+// NewContextWithoutFilters returns a context whose loggers write all their entries, whatever the
+// levels and the sampling, e.g. so that tests capture them without changing the global levels,
+// see ocmlogtest.
+func NewContextWithoutFilters(ctx context.Context) context.Context {
+	return context.WithValue(ctx, unfilteredContextKey{}, true)
+}
+
+// unfilteredContext tells whether the context was returned by NewContextWithoutFilters.
+func unfilteredContext(ctx context.Context) bool {
+	if ctx == nil {
+		return false
+	}
+	unfiltered, _ := ctx.Value(unfilteredContextKey{}).(bool)
+	return unfiltered
+}
@@ -39,6 +39,12 @@ type ContextualLogger interface {
 	Warning(msg string, keysAndValues ...interface{})
 	WarningWithError(err error, msg string, keysAndValues ...interface{})
 	Fatal(err error, msg string, keysAndValues ...interface{})
+
+	// WithValues returns a child logger adding the key/values to all its entries, like logr.
+	WithValues(keysAndValues ...interface{}) ContextualLogger
+
+	// WithName returns a child logger with name appended to its name, like logr.
+	WithName(name string) ContextualLogger
 }
 
 type contextualWrapper struct {
@@ -48,33 +54,41 @@ type contextualWrapper struct {
 var _ ContextualLogger = &contextualWrapper{}
 
 func (c *contextualWrapper) Debug(msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.DebugLevel, msg, nil, keysAndValues)
+	c.delegate.log(zerolog.DebugLevel, msg, msg, nil, keysAndValues)
 }
 
 func (c *contextualWrapper) Trace(msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.TraceLevel, msg, nil, keysAndValues)
+	c.delegate.log(zerolog.TraceLevel, msg, msg, nil, keysAndValues)
 }
 
 func (c *contextualWrapper) Info(msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.InfoLevel, msg, nil, keysAndValues)
+	c.delegate.log(zerolog.InfoLevel, msg, msg, nil, keysAndValues)
 }
 
 func (c *contextualWrapper) InfoWithError(err error, msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.InfoLevel, msg, err, keysAndValues)
+	c.delegate.log(zerolog.InfoLevel, msg, msg, err, keysAndValues)
 }
 
 func (c *contextualWrapper) Warning(msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.WarnLevel, msg, nil, keysAndValues)
+	c.delegate.log(zerolog.WarnLevel, msg, msg, nil, keysAndValues)
 }
 
 func (c *contextualWrapper) WarningWithError(err error, msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.WarnLevel, msg, err, keysAndValues)
+	c.delegate.log(zerolog.WarnLevel, msg, msg, err, keysAndValues)
 }
 
 func (c *contextualWrapper) Error(err error, msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.ErrorLevel, msg, err, keysAndValues)
+	c.delegate.log(zerolog.ErrorLevel, msg, msg, err, keysAndValues)
 }
 
 func (c *contextualWrapper) Fatal(err error, msg string, keysAndValues ...interface{}) {
-	c.delegate.log(zerolog.FatalLevel, msg, err, keysAndValues)
+	c.delegate.log(zerolog.FatalLevel, msg, msg, err, keysAndValues)
+}
+
+func (c *contextualWrapper) WithValues(keysAndValues ...interface{}) ContextualLogger {
+	return &contextualWrapper{delegate: c.delegate.withValues(keysAndValues)}
+}
+
+func (c *contextualWrapper) WithName(name string) ContextualLogger {
+	return &contextualWrapper{delegate: c.delegate.withName(name)}
 }
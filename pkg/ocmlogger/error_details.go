@@ -0,0 +1,172 @@
+package ocmlogger
+
+import (
+	"fmt"
+	"net/http"
+	"sync/atomic"
+
+	pkgerrors "github.com/pkg/errors"
+	"github.com/rs/zerolog"
+	"github.com/zgalor/weberr"
+)
+
+const (
+	errorChainFieldName = "error_chain"
+	errorCodeFieldName  = "error_code"
+	errorTypeFieldName  = "error_type"
+
+	defaultMaxErrorChainLength = 10
+	defaultMaxErrorStackSize   = 4096
+
+	// truncatedStackSuffix ends the stacks longer than the MaxStackSize.
+	truncatedStackSuffix = "\n..."
+)
+
+// ErrorDetailsConfig selects what is written about the logged errors besides their message.
+type ErrorDetailsConfig struct {
+	// Chain writes the type and message of the wrapped errors, following Unwrap, errors.Join and
+	// the Cause of github.com/pkg/errors and github.com/zgalor/weberr, as `error_chain`. It is only
+	// written when the error wraps others.
+	Chain bool
+
+	// MaxChainLength is the maximum number of errors of the chain, 10 by default.
+	MaxChainLength int
+
+	// WebErr writes the HTTP code and its status text of the first github.com/zgalor/weberr typed
+	// error of the chain as `error_code` and `error_type`.
+	WebErr bool
+
+	// Stack writes the stack trace of the innermost github.com/pkg/errors error of the chain, where
+	// the error was created, as `stack`.
+	Stack bool
+
+	// MaxStackSize is the maximum number of bytes of the stack, 4096 by default.
+	MaxStackSize int
+}
+
+// errorChainLink is an error of the chain, as written in the `error_chain` field.
+type errorChainLink struct {
+	Type    string `json:"type"`
+	Message string `json:"message"`
+}
+
+// stackTracer is implemented by the errors of github.com/pkg/errors.
+type stackTracer interface {
+	StackTrace() pkgerrors.StackTrace
+}
+
+// typedError is implemented by the errors of github.com/zgalor/weberr.
+type typedError interface {
+	Type() weberr.ErrorType
+}
+
+// causer is implemented by the wrapping errors of github.com/pkg/errors and github.com/zgalor/weberr.
+type causer interface {
+	Cause() error
+}
+
+// currentErrorDetails is nil by default, so that the entries of the legacy schema don't change.
+var currentErrorDetails atomic.Pointer[ErrorDetailsConfig]
+
+// SetErrorDetails - update what is written about the logged errors of all loggers. A nil config,
+// the default, only writes the error message.
+func SetErrorDetails(config *ErrorDetailsConfig) {
+	if config != nil {
+		updated := *config
+		if updated.MaxChainLength <= 0 {
+			updated.MaxChainLength = defaultMaxErrorChainLength
+		}
+		if updated.MaxStackSize <= 0 {
+			updated.MaxStackSize = defaultMaxErrorStackSize
+		}
+		config = &updated
+	}
+	currentErrorDetails.Store(config)
+}
+
+// addErrorDetails writes the chain, the weberr type and the stack of the error, as configured.
+func addErrorDetails(event *zerolog.Event, err error) *zerolog.Event {
+	config := currentErrorDetails.Load()
+	if config == nil || err == nil {
+		return event
+	}
+	// the redacted message replaces the one of the original error, the chain starts after it
+	if redacted, ok := err.(*redactedError); ok {
+		err = redacted.cause
+	}
+	chain := errorChain(err, config.MaxChainLength)
+
+	if config.Chain && len(chain) > 1 {
+		redactor := GetRedactor()
+		links := make([]errorChainLink, len(chain))
+		for i, link := range chain {
+			message := link.Error()
+			if redactor != nil {
+				message = redactor.RedactString(message)
+			}
+			links[i] = errorChainLink{Type: fmt.Sprintf("%T", link), Message: message}
+		}
+		event = event.Interface(errorChainFieldName, links)
+	}
+	if config.WebErr {
+		for _, link := range chain {
+			if typed, ok := link.(typedError); ok && typed.Type() != weberr.NoType {
+				code := int(typed.Type())
+				event = event.Int(errorCodeFieldName, code).Str(errorTypeFieldName, http.StatusText(code))
+				break
+			}
+		}
+	}
+	if config.Stack {
+		var innermost stackTracer
+		for _, link := range chain {
+			if tracer, ok := link.(stackTracer); ok {
+				innermost = tracer
+			}
+		}
+		if innermost != nil {
+			event = event.Str(zerolog.ErrorStackFieldName, truncateStack(
+				fmt.Sprintf("%+v", innermost.StackTrace()), config.MaxStackSize))
+		}
+	}
+	return event
+}
+
+// errorChain returns the error followed by the ones it wraps, depth first, up to maxLength errors.
+func errorChain(err error, maxLength int) []error {
+	var chain []error
+	var walk func(err error)
+	walk = func(err error) {
+		if err == nil || len(chain) >= maxLength {
+			return
+		}
+		chain = append(chain, err)
+		switch wrapper := err.(type) {
+		case interface{ Unwrap() []error }:
+			for _, wrapped := range wrapper.Unwrap() {
+				walk(wrapped)
+			}
+		case interface{ Unwrap() error }:
+			walk(wrapper.Unwrap())
+		case causer:
+			walk(wrapper.Cause())
+		}
+	}
+	walk(err)
+	return chain
+}
+
+// truncateStack cuts the stack to maxSize bytes at most, at the end of a line when possible.
+func truncateStack(stack string, maxSize int) string {
+	if len(stack) <= maxSize {
+		return stack
+	}
+	cut := stack[:max(maxSize-len(truncatedStackSuffix), 0)]
+	for i := len(cut) - 1; i > 0; i-- {
+		if cut[i] == '\n' {
+			cut = cut[:i]
+			break
+		}
+	}
+	return cut + truncatedStackSuffix
+}
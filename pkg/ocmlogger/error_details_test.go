@@ -0,0 +1,107 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	pkgerrors "github.com/pkg/errors"
+	"github.com/zgalor/weberr"
+)
+
+var _ = Describe("logger error details", Label("logger"), func() {
+	var (
+		output ThreadSafeBytesBuffer
+		ulog   OCMLogger
+	)
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		ulog = NewOCMLogger(context.Background()).CaptureSentryEvent(false)
+		SetErrorDetails(&ErrorDetailsConfig{Chain: true, WebErr: true, Stack: true})
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			SetErrorDetails(nil)
+		})
+	})
+
+	entry := func() map[string]interface{} {
+		result := map[string]interface{}{}
+		Expect(json.Unmarshal([]byte(output.String()), &result)).To(Succeed())
+		return result
+	}
+
+	It("writes the chain of wrapped and joined errors", func() {
+		err := fmt.Errorf("reading: %w", errors.Join(errors.New("first"), errors.New("second")))
+		ulog.Contextual().Error(err, "failed")
+
+		Expect(entry()[errorChainFieldName]).To(Equal([]interface{}{
+			map[string]interface{}{"type": "*fmt.wrapError", "message": "reading: first\nsecond"},
+			map[string]interface{}{"type": "*errors.joinError", "message": "first\nsecond"},
+			map[string]interface{}{"type": "*errors.errorString", "message": "first"},
+			map[string]interface{}{"type": "*errors.errorString", "message": "second"},
+		}))
+	})
+
+	It("writes no chain for errors wrapping nothing", func() {
+		ulog.Contextual().Error(errors.New("plain"), "failed")
+		Expect(entry()).NotTo(HaveKey(errorChainFieldName))
+	})
+
+	It("limits the length of the chain", func() {
+		SetErrorDetails(&ErrorDetailsConfig{Chain: true, MaxChainLength: 2})
+		ulog.Contextual().Error(fmt.Errorf("a: %w", fmt.Errorf("b: %w", errors.New("c"))), "failed")
+		Expect(entry()[errorChainFieldName]).To(HaveLen(2))
+	})
+
+	It("redacts the messages of the chain", func() {
+		err := fmt.Errorf("login: %w", errors.New("invalid token "+testJWT))
+		ulog.Contextual().Error(err, "failed")
+
+		Expect(output.String()).NotTo(ContainSubstring(testJWT))
+		Expect(entry()[errorChainFieldName]).To(HaveLen(2))
+	})
+
+	It("writes the weberr type of the chain", func() {
+		err := fmt.Errorf("finding cluster: %w", weberr.NotFound.Errorf("cluster not found"))
+		ulog.Contextual().Error(err, "failed")
+
+		result := entry()
+		Expect(result[errorCodeFieldName]).To(BeNumerically("==", 404))
+		Expect(result[errorTypeFieldName]).To(Equal("Not Found"))
+		Expect(result[errorChainFieldName]).To(ContainElement(
+			HaveKeyWithValue("message", "cluster not found")))
+	})
+
+	It("writes the stack of pkg/errors, truncated", func() {
+		ulog.Contextual().Error(pkgerrors.Wrap(pkgerrors.New("root"), "wrapped"), "failed")
+		stack, _ := entry()["stack"].(string)
+		Expect(stack).To(ContainSubstring("error_details_test.go"))
+
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		SetErrorDetails(&ErrorDetailsConfig{Stack: true, MaxStackSize: 100})
+		ulog.Contextual().Error(pkgerrors.New("root"), "failed")
+		stack, _ = entry()["stack"].(string)
+		Expect(len(stack)).To(BeNumerically("<=", 100))
+		Expect(strings.HasSuffix(stack, truncatedStackSuffix)).To(BeTrue())
+	})
+
+	It("only writes the message by default", func() {
+		SetErrorDetails(nil)
+		ulog.Contextual().Error(pkgerrors.Wrap(weberr.BadRequest.Errorf("bad"), "wrapped"), "failed")
+
+		result := entry()
+		Expect(result).To(HaveKeyWithValue("error", "wrapped: bad"))
+		Expect(result).NotTo(HaveKey(errorChainFieldName))
+		Expect(result).NotTo(HaveKey(errorCodeFieldName))
+		Expect(result).NotTo(HaveKey("stack"))
+	})
+})
@@ -0,0 +1,132 @@
+package ocmlogger
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"sync/atomic"
+)
+
+// OptionalExtraDataCallback retrieves a value from the context, the key is omitted from the entry
+// when it returns false.
+type OptionalExtraDataCallback func(ctx context.Context) (any, bool)
+
+// ExtraDataRegistry holds the callbacks retrieving values from the contexts of the loggers, see
+// RegisterExtraDataCallback. The values are added to the entries in the order the keys were first
+// registered. It is safe for concurrent use.
+type ExtraDataRegistry struct {
+	lock sync.Mutex
+	// entries is replaced on every change, so that loggers read it without locking
+	entries atomic.Pointer[[]extraDataEntry]
+}
+
+type extraDataEntry struct {
+	key      string
+	callback OptionalExtraDataCallback
+}
+
+// The context in go requires key to be `exactly the same` both when setting with context.WithValue and getting with context.Value
+// It makes library being unable to fetch those keys by itself if they are not `string` (even if its underlying type is `string`
+// For example:
+//
+//	const OpIDKey OperationIDKey = "opID"
+//	opID := util.NewID()
+//	ctx = context.WithValue(ctx, OpIDKey, opID)
+//
+//	opID, ok := ctx.Value(OpIDKey).(string) -- this will work
+//	opID, ok := ctx.Value("opID").(string) -- this will NOT work
+//
+// We allow you to register callback functions to safely retrieve values from the context. The values returned
+// by those functions will be added to the log as `Extra` fields under the provided key.
+var defaultExtraDataRegistry = NewExtraDataRegistry()
+
+// NewExtraDataRegistry returns an empty registry, to give to ScopedLogger.WithExtraDataRegistry.
+func NewExtraDataRegistry() *ExtraDataRegistry {
+	r := &ExtraDataRegistry{}
+	r.entries.Store(&[]extraDataEntry{})
+	return r
+}
+
+// Register adds the value returned by the callback to the entries under the key, replacing the
+// callback registered for the key, if any. A nil callback unregisters the key.
+func (r *ExtraDataRegistry) Register(key string, callback func(ctx context.Context) any) {
+	if callback == nil {
+		r.Unregister(key)
+		return
+	}
+	r.RegisterOptional(key, func(ctx context.Context) (any, bool) {
+		return callback(ctx), true
+	})
+}
+
+// RegisterOptional is Register for callbacks that may omit the key.
+func (r *ExtraDataRegistry) RegisterOptional(key string, callback OptionalExtraDataCallback) {
+	if callback == nil {
+		r.Unregister(key)
+		return
+	}
+	r.update(func(entries []extraDataEntry) []extraDataEntry {
+		for i := range entries {
+			if entries[i].key == key {
+				entries[i].callback = callback
+				return entries
+			}
+		}
+		return append(entries, extraDataEntry{key: key, callback: callback})
+	})
+}
+
+// Unregister removes the callback of the key.
+func (r *ExtraDataRegistry) Unregister(key string) {
+	r.update(func(entries []extraDataEntry) []extraDataEntry {
+		return slices.DeleteFunc(entries, func(entry extraDataEntry) bool {
+			return entry.key == key
+		})
+	})
+}
+
+// Clear removes all the callbacks.
+func (r *ExtraDataRegistry) Clear() {
+	r.update(func([]extraDataEntry) []extraDataEntry {
+		return nil
+	})
+}
+
+// update applies the change to a copy of the entries.
+func (r *ExtraDataRegistry) update(change func(entries []extraDataEntry) []extraDataEntry) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	entries := change(slices.Clone(*r.entries.Load()))
+	r.entries.Store(&entries)
+}
+
+// appendExtras appends the keys and the values the callbacks retrieve from the context.
+func (r *ExtraDataRegistry) appendExtras(keysAndValues []interface{}, ctx context.Context) []interface{} {
+	for _, entry := range *r.entries.Load() {
+		if value, found := entry.callback(ctx); found {
+			keysAndValues = append(keysAndValues, entry.key, value)
+		}
+	}
+	return keysAndValues
+}
+
+// RegisterExtraDataCallback adds the value returned by the callback to the entries of all loggers
+// under the key, see ExtraDataRegistry.Register.
+func RegisterExtraDataCallback(key string, callback func(ctx context.Context) any) {
+	defaultExtraDataRegistry.Register(key, callback)
+}
+
+// RegisterOptionalExtraDataCallback is RegisterExtraDataCallback for callbacks that may omit the key.
+func RegisterOptionalExtraDataCallback(key string, callback OptionalExtraDataCallback) {
+	defaultExtraDataRegistry.RegisterOptional(key, callback)
+}
+
+// UnregisterExtraDataCallback removes the callback of the key registered for all loggers.
+func UnregisterExtraDataCallback(key string) {
+	defaultExtraDataRegistry.Unregister(key)
+}
+
+// ClearExtraDataCallbacks removes all the callbacks registered for all loggers.
+func ClearExtraDataCallbacks() {
+	defaultExtraDataRegistry.Clear()
+}
@@ -0,0 +1,103 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+type extraDataKey string
+
+var _ = Describe("extra data callbacks", Label("logger"), func() {
+	var (
+		output ThreadSafeBytesBuffer
+		ctx    context.Context
+	)
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		SetLogSchema(LogSchemaV2)
+		ctx = context.WithValue(context.Background(), extraDataKey("opID"), "op-1")
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			SetLogSchema(LogSchemaLegacy)
+			ClearExtraDataCallbacks()
+		})
+	})
+
+	opID := func(ctx context.Context) any {
+		return ctx.Value(extraDataKey("opID"))
+	}
+
+	It("adds the values in registration order", func() {
+		RegisterExtraDataCallback("b", func(context.Context) any { return 1 })
+		RegisterExtraDataCallback("a", func(context.Context) any { return 2 })
+		RegisterExtraDataCallback("c", opID)
+		RegisterExtraDataCallback("b", func(context.Context) any { return 3 })
+
+		NewOCMLogger(ctx).Warning("warning")
+		Expect(output.String()).To(ContainSubstring(`"b":3,"a":2,"c":"op-1"`))
+	})
+
+	It("unregisters single keys", func() {
+		RegisterExtraDataCallback("opID", opID)
+		RegisterExtraDataCallback("other", opID)
+		UnregisterExtraDataCallback("other")
+
+		NewOCMLogger(ctx).Warning("warning")
+		Expect(output.String()).To(ContainSubstring(`"opID":"op-1"`))
+		Expect(output.String()).NotTo(ContainSubstring("other"))
+	})
+
+	It("omits the keys of absent values", func() {
+		RegisterOptionalExtraDataCallback("opID", func(ctx context.Context) (any, bool) {
+			value, found := ctx.Value(extraDataKey("opID")).(string)
+			return value, found
+		})
+
+		NewOCMLogger(context.Background()).Warning("without")
+		Expect(output.String()).NotTo(ContainSubstring("opID"))
+		NewOCMLogger(ctx).Warning("with")
+		Expect(output.String()).To(ContainSubstring(`"opID":"op-1"`))
+	})
+
+	It("adds the values of the logger registry", func() {
+		RegisterExtraDataCallback("global", func(context.Context) any { return "g" })
+		registry := NewExtraDataRegistry()
+		registry.Register("opID", opID)
+
+		log := NewOCMLogger(ctx)
+		log.(ScopedLogger).WithExtraDataRegistry(registry).WithValues("k", "v").Warning("scoped")
+		log.Warning("unscoped")
+
+		lines := bytes.Split(bytes.TrimSpace([]byte(output.String())), []byte("\n"))
+		Expect(lines).To(HaveLen(2))
+		Expect(string(lines[0])).To(ContainSubstring(`"global":"g","opID":"op-1"`))
+		Expect(string(lines[1])).To(ContainSubstring(`"global":"g"`))
+		Expect(string(lines[1])).NotTo(ContainSubstring("opID"))
+	})
+
+	It("is safe for concurrent use", func() {
+		var wait sync.WaitGroup
+		for i := 0; i < 20; i++ {
+			wait.Add(2)
+			go func() {
+				defer wait.Done()
+				key := fmt.Sprintf("key%d", i%5)
+				RegisterExtraDataCallback(key, opID)
+				UnregisterExtraDataCallback(key)
+			}()
+			go func() {
+				defer wait.Done()
+				NewOCMLogger(ctx).Warning("concurrent")
+			}()
+		}
+		wait.Wait()
+	})
+})
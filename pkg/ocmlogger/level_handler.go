@@ -0,0 +1,223 @@
+package ocmlogger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LevelState is the body of the responses of the level handler.
+type LevelState struct {
+	// Level is the global level, see SetLogLevel.
+	Level string `json:"level"`
+
+	// Overrides are the per package and per logger levels, see SetLogLevelOverrides.
+	Overrides string `json:"overrides"`
+
+	// RevertAt is when the levels will be restored to their values before the first change made
+	// with a TTL, if any.
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+// LevelChange is the body of the PUT requests of the level handler. Omitted fields are unchanged.
+type LevelChange struct {
+	Level     *string `json:"level,omitempty"`
+	Overrides *string `json:"overrides,omitempty"`
+
+	// TTL is a duration like `15m` after which the levels are reverted. Without it the change is
+	// permanent.
+	TTL string `json:"ttl,omitempty"`
+}
+
+// LevelHandlerOption configures the handler returned by NewLevelHandler.
+type LevelHandlerOption func(*levelHandler)
+
+// WithLevelHandlerAuth sets a function authorizing the requests, they are rejected with a 403 when
+// it returns an error.
+func WithLevelHandlerAuth(authorize func(*http.Request) error) LevelHandlerOption {
+	return func(h *levelHandler) {
+		h.authorize = authorize
+	}
+}
+
+// WithLevelHandlerMaxTTL limits the TTL of the changes, longer ones are rejected with a 400.
+func WithLevelHandlerMaxTTL(maxTTL time.Duration) LevelHandlerOption {
+	return func(h *levelHandler) {
+		h.maxTTL = maxTTL
+	}
+}
+
+type levelHandler struct {
+	authorize func(*http.Request) error
+	maxTTL    time.Duration
+
+	lock sync.Mutex
+	// revert holds the levels to restore when the timer fires, nil when there is nothing to revert.
+	revert      *LevelState
+	revertTimer *time.Timer
+	// generation counts the changes, a timer that fired after a newer change doesn't revert it.
+	generation uint64
+}
+
+// NewLevelHandler returns a handler to read and change the log levels of a running process:
+//   - GET returns the current LevelState
+//   - PUT applies a LevelChange and returns the new LevelState
+//
+// When a change has a TTL the levels are restored after it to the values they had before the first
+// change that is still pending revert. A change without TTL cancels any pending revert. Every
+// change is logged at warning level. Without WithLevelHandlerAuth the handler doesn't authenticate
+// its callers, it must be mounted on an admin only route.
+func NewLevelHandler(opts ...LevelHandlerOption) http.Handler {
+	h := &levelHandler{}
+	for _, opt := range opts {
+		opt(h)
+	}
+	return h
+}
+
+func (h *levelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if h.authorize != nil {
+		if err := h.authorize(r); err != nil {
+			http.Error(w, fmt.Sprintf("not authorized: %v", err), http.StatusForbidden)
+			return
+		}
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		writeLevelState(w, h.state())
+	case http.MethodPut:
+		change := LevelChange{}
+		if err := json.NewDecoder(r.Body).Decode(&change); err != nil {
+			http.Error(w, fmt.Sprintf("invalid body: %v", err), http.StatusBadRequest)
+			return
+		}
+		state, err := h.apply(r, change)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeLevelState(w, state)
+	default:
+		w.Header().Set("Allow", "GET, PUT")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *levelHandler) apply(r *http.Request, change LevelChange) (LevelState, error) {
+	var ttl time.Duration
+	if change.TTL != "" {
+		var err error
+		if ttl, err = time.ParseDuration(change.TTL); err != nil || ttl <= 0 {
+			return LevelState{}, fmt.Errorf("invalid ttl '%s', expected a positive duration like 15m", change.TTL)
+		}
+		if h.maxTTL > 0 && ttl > h.maxTTL {
+			return LevelState{}, fmt.Errorf("ttl %s is longer than the maximum of %s", ttl, h.maxTTL)
+		}
+	}
+
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	// validate everything before changing anything
+	previous := currentLevelState()
+	next := previous
+	if change.Level != nil {
+		level, err := zerolog.ParseLevel(*change.Level)
+		if err != nil || level == zerolog.NoLevel {
+			return LevelState{}, fmt.Errorf("invalid level '%s', one of: %v", *change.Level, possibleLogLevels)
+		}
+		next.Level = level.String()
+	}
+	if change.Overrides != nil {
+		overrides, err := parseLevelOverrides(*change.Overrides)
+		if err != nil {
+			return LevelState{}, err
+		}
+		next.Overrides = overrides.String()
+	}
+
+	if h.revertTimer != nil {
+		h.revertTimer.Stop()
+		h.revertTimer = nil
+	}
+	h.generation++
+	if ttl == 0 {
+		h.revert = nil
+	} else if h.revert == nil {
+		h.revert = &previous
+	}
+	err := applyLevelState(r.Context(), "Log levels changed", next, "ttl", change.TTL, "remote_addr", r.RemoteAddr)
+	if err != nil {
+		return LevelState{}, err
+	}
+	if ttl > 0 {
+		revertAt := time.Now().Add(ttl)
+		h.revert.RevertAt = &revertAt
+		generation := h.generation
+		h.revertTimer = time.AfterFunc(ttl, func() {
+			h.revertLevels(generation)
+		})
+	}
+	return h.stateLocked(), nil
+}
+
+// revertLevels restores the levels, unless they changed again since the given generation.
+func (h *levelHandler) revertLevels(generation uint64) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	if h.revert == nil || h.generation != generation {
+		return
+	}
+	revert := *h.revert
+	h.revert = nil
+	h.revertTimer = nil
+	if err := applyLevelState(context.Background(), "Log levels reverted", revert); err != nil {
+		NewOCMLogger(context.Background()).Contextual().Error(err, "Failed to revert log levels")
+	}
+}
+
+// applyLevelState changes the levels and logs the change at warning level, whatever the levels, so
+// that every change is audited.
+func applyLevelState(ctx context.Context, message string, next LevelState, keysAndValues ...interface{}) error {
+	previous := currentLevelState()
+	audit := &logger{ctx: ctx, unsampled: true, alwaysEnabled: true}
+	audit.log(zerolog.WarnLevel, message, message, nil, append([]interface{}{
+		"previous_level", previous.Level,
+		"previous_overrides", previous.Overrides,
+		"level", next.Level,
+		"overrides", next.Overrides,
+	}, keysAndValues...))
+	if err := SetLogLevel(next.Level); err != nil {
+		return err
+	}
+	return SetLogLevelOverrides(next.Overrides)
+}
+
+func (h *levelHandler) state() LevelState {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	return h.stateLocked()
+}
+
+func (h *levelHandler) stateLocked() LevelState {
+	state := currentLevelState()
+	if h.revert != nil {
+		state.RevertAt = h.revert.RevertAt
+	}
+	return state
+}
+
+func currentLevelState() LevelState {
+	return LevelState{Level: GetLogLevel(), Overrides: GetLogLevelOverrides()}
+}
+
+func writeLevelState(w http.ResponseWriter, state LevelState) {
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(state)
+}
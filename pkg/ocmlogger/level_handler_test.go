@@ -0,0 +1,203 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("level handler", Label("logger"), func() {
+	var (
+		handler http.Handler
+		output  ThreadSafeBytesBuffer
+	)
+
+	serve := func(method, body string) (*httptest.ResponseRecorder, LevelState) {
+		recorder := httptest.NewRecorder()
+		handler.ServeHTTP(recorder, httptest.NewRequest(method, "/", strings.NewReader(body)))
+		state := LevelState{}
+		if recorder.Code == http.StatusOK {
+			Expect(json.Unmarshal(recorder.Body.Bytes(), &state)).To(Succeed())
+		}
+		return recorder, state
+	}
+
+	BeforeEach(func() {
+		handler = NewLevelHandler()
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		globalLevel := GetLogLevel()
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			Expect(SetLogLevelOverrides("")).To(Succeed())
+			Expect(SetLogLevel(globalLevel)).To(Succeed())
+		})
+		Expect(SetLogLevel("warn")).To(Succeed())
+	})
+
+	It("returns the current levels", func() {
+		Expect(SetLogLevelOverrides("pkg/middleware=debug")).To(Succeed())
+		recorder, state := serve(http.MethodGet, "")
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(state).To(Equal(LevelState{Level: "warn", Overrides: "pkg/middleware=debug"}))
+	})
+
+	It("changes the levels and logs the change", func() {
+		recorder, state := serve(http.MethodPut, `{"level":"info","overrides":"pkg/client=trace"}`)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(state).To(Equal(LevelState{Level: "info", Overrides: "pkg/client=trace"}))
+		Expect(GetLogLevel()).To(Equal("info"))
+		Expect(GetLogLevelOverrides()).To(Equal("pkg/client=trace"))
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"message\":\"Log levels changed\""))
+		Expect(result).To(ContainSubstring("\"previous_level\":\"warn\""))
+
+		// omitted fields are unchanged
+		_, state = serve(http.MethodPut, `{"level":"error"}`)
+		Expect(state).To(Equal(LevelState{Level: "error", Overrides: "pkg/client=trace"}))
+	})
+
+	It("logs every change, whatever the levels", func() {
+		serve(http.MethodPut, `{"level":"error"}`)
+		Expect(output.String()).To(ContainSubstring("\"level\":\"error\""))
+
+		// including the ones while warnings are disabled
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		serve(http.MethodPut, `{"level":"fatal"}`)
+		Expect(output.String()).To(ContainSubstring("\"previous_level\":\"error\""))
+		serve(http.MethodPut, `{"overrides":"pkg/client=error"}`)
+		Expect(output.String()).To(ContainSubstring("\"overrides\":\"pkg/client=error\""))
+		serve(http.MethodPut, `{"level":"info"}`)
+		Expect(output.String()).To(ContainSubstring("\"previous_level\":\"fatal\""))
+
+		// the audit entries don't enable the other ones
+		NewOCMLogger(context.Background()).Debug("not logged")
+		Expect(output.String()).NotTo(ContainSubstring("not logged"))
+	})
+
+	It("doesn't revert a newer change with a timer that already fired", func() {
+		levels := handler.(*levelHandler)
+		serve(http.MethodPut, `{"level":"debug","ttl":"1h"}`)
+		levels.lock.Lock()
+		stale := levels.generation
+		levels.lock.Unlock()
+		serve(http.MethodPut, `{"level":"info","ttl":"1h"}`)
+
+		// as if the first timer fired just before being stopped by the second change
+		levels.revertLevels(stale)
+		Expect(GetLogLevel()).To(Equal("info"))
+
+		levels.lock.Lock()
+		current := levels.generation
+		levels.lock.Unlock()
+		levels.revertLevels(current)
+		Expect(GetLogLevel()).To(Equal("warn"))
+	})
+
+	It("reverts the levels after the ttl", func() {
+		_, state := serve(http.MethodPut, `{"level":"debug","ttl":"100ms"}`)
+		Expect(state.Level).To(Equal("debug"))
+		Expect(state.RevertAt).NotTo(BeNil())
+
+		// a second change reverts to the levels before the first one
+		_, state = serve(http.MethodPut, `{"overrides":"pkg/client=trace","ttl":"100ms"}`)
+		Expect(state.RevertAt).NotTo(BeNil())
+
+		Eventually(GetLogLevel).WithTimeout(time.Second).Should(Equal("warn"))
+		Expect(GetLogLevelOverrides()).To(Equal(""))
+		_, state = serve(http.MethodGet, "")
+		Expect(state.RevertAt).To(BeNil())
+		Expect(output.String()).To(ContainSubstring("\"message\":\"Log levels reverted\""))
+	})
+
+	It("cancels the revert with a permanent change", func() {
+		serve(http.MethodPut, `{"level":"debug","ttl":"50ms"}`)
+		_, state := serve(http.MethodPut, `{"level":"info"}`)
+		Expect(state.RevertAt).To(BeNil())
+		Consistently(GetLogLevel).WithTimeout(200 * time.Millisecond).Should(Equal("info"))
+	})
+
+	It("changes the levels while other goroutines log", func() {
+		done := make(chan struct{})
+		var started, wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			started.Add(1)
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				ulog := NewOCMLogger(context.Background())
+				ulog.Warning("concurrent")
+				started.Done()
+				for {
+					select {
+					case <-done:
+						return
+					default:
+						ulog.Warning("concurrent")
+					}
+				}
+			}()
+		}
+		started.Wait()
+		for _, level := range []string{"info", "error", "debug", "warn"} {
+			recorder, _ := serve(http.MethodPut, `{"level":"`+level+`"}`)
+			Expect(recorder.Code).To(Equal(http.StatusOK))
+		}
+		close(done)
+		wg.Wait()
+		Expect(output.String()).To(ContainSubstring("\"message\":\"concurrent\""))
+	})
+
+	It("rejects invalid changes without applying them", func() {
+		for _, body := range []string{
+			`{"level":"loud"}`,
+			`{"level":""}`,
+			`{"level":"debug","overrides":"pkg/client"}`,
+			`{"level":"debug","ttl":"soon"}`,
+			`{"level":"debug","ttl":"-1m"}`,
+			`not json`,
+		} {
+			recorder, _ := serve(http.MethodPut, body)
+			Expect(recorder.Code).To(Equal(http.StatusBadRequest), body)
+		}
+		Expect(GetLogLevel()).To(Equal("warn"))
+
+		handler = NewLevelHandler(WithLevelHandlerMaxTTL(time.Hour))
+		recorder, _ := serve(http.MethodPut, `{"level":"debug","ttl":"2h"}`)
+		Expect(recorder.Code).To(Equal(http.StatusBadRequest))
+
+		recorder, _ = serve(http.MethodPost, `{}`)
+		Expect(recorder.Code).To(Equal(http.StatusMethodNotAllowed))
+	})
+
+	It("authorizes the requests", func() {
+		handler = NewLevelHandler(WithLevelHandlerAuth(func(r *http.Request) error {
+			if r.Header.Get("Authorization") != "Bearer admin" {
+				return errors.New("admin token required")
+			}
+			return nil
+		}))
+		recorder, _ := serve(http.MethodPut, `{"level":"debug"}`)
+		Expect(recorder.Code).To(Equal(http.StatusForbidden))
+		Expect(GetLogLevel()).To(Equal("warn"))
+
+		request := httptest.NewRequest(http.MethodPut, "/", strings.NewReader(`{"level":"debug"}`))
+		request.Header.Set("Authorization", "Bearer admin")
+		recorder = httptest.NewRecorder()
+		handler.ServeHTTP(recorder, request)
+		Expect(recorder.Code).To(Equal(http.StatusOK))
+		Expect(GetLogLevel()).To(Equal("debug"))
+	})
+})
@@ -0,0 +1,188 @@
+package ocmlogger
+
+import (
+	"fmt"
+	"path"
+	"runtime"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/rs/zerolog"
+)
+
+var (
+	OCM_LOG_LEVEL_OVERRIDES_FLAG_NAME = "log-level-overrides"
+
+	// globalLevel is the level set with SetLogLevel, used when no override applies.
+	globalLevel atomic.Int32
+
+	// minLevel is the most verbose level enabled anywhere, below it nothing is logged and the
+	// caller doesn't need to be resolved.
+	minLevel atomic.Int32
+
+	// levelOverrides holds the current *levelOverrideConfig, nil when there are no overrides.
+	levelOverrides atomic.Pointer[levelOverrideConfig]
+
+	// callerPackages caches the package of each call site, keyed by program counter.
+	callerPackages sync.Map
+
+	// levelsLock serializes the updates of the levels, reads only use the atomics above.
+	levelsLock sync.Mutex
+)
+
+// levelOverrideConfig maps packages (e.g. `pkg/middleware`) and logger names to levels. Keys are
+// hierarchical: `pkg/client` applies to `pkg/client/segment` unless it has its own entry.
+type levelOverrideConfig struct {
+	levels map[string]zerolog.Level
+}
+
+// SetLogLevelOverrides - set levels for specific packages or named loggers, overriding the global
+// level set with SetLogLevel. The config is a comma separated list like
+// `pkg/middleware=debug,pkg/client/segment=trace`. Packages are the directory of the caller file
+// as shown in the `caller` field, named loggers are created with NewNamedOCMLogger. An empty config
+// removes all the overrides.
+func SetLogLevelOverrides(config string) error {
+	overrides, err := parseLevelOverrides(config)
+	if err != nil {
+		return err
+	}
+
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	if len(overrides.levels) == 0 {
+		levelOverrides.Store(nil)
+	} else {
+		levelOverrides.Store(overrides)
+	}
+	applyLevels()
+	return nil
+}
+
+// GetLogLevelOverrides returns the current overrides in the format accepted by SetLogLevelOverrides.
+func GetLogLevelOverrides() string {
+	overrides := levelOverrides.Load()
+	if overrides == nil {
+		return ""
+	}
+	return overrides.String()
+}
+
+// GetLogLevel returns the global level set with SetLogLevel.
+func GetLogLevel() string {
+	return zerolog.Level(globalLevel.Load()).String()
+}
+
+func parseLevelOverrides(config string) (*levelOverrideConfig, error) {
+	overrides := &levelOverrideConfig{levels: map[string]zerolog.Level{}}
+	for _, entry := range strings.Split(config, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		key, levelName, found := strings.Cut(entry, "=")
+		key = strings.Trim(strings.TrimSpace(key), "/")
+		if !found || key == "" {
+			return nil, fmt.Errorf("invalid log level override '%s', expected <package or logger>=<level>", entry)
+		}
+		level, err := zerolog.ParseLevel(strings.TrimSpace(levelName))
+		if err != nil {
+			return nil, fmt.Errorf("invalid log level override '%s': %w", entry, err)
+		}
+		overrides.levels[key] = level
+	}
+	return overrides, nil
+}
+
+func (o *levelOverrideConfig) String() string {
+	entries := make([]string, 0, len(o.levels))
+	for key, level := range o.levels {
+		entries = append(entries, key+"="+level.String())
+	}
+	sort.Strings(entries)
+	return strings.Join(entries, ",")
+}
+
+// lookup returns the level of the most specific key matching name, e.g. `pkg/client` matches
+// `pkg/client/segment` but not `pkg/clients`.
+func (o *levelOverrideConfig) lookup(name string) (zerolog.Level, bool) {
+	for name != "" {
+		if level, found := o.levels[name]; found {
+			return level, true
+		}
+		i := strings.LastIndex(name, "/")
+		if i < 0 {
+			break
+		}
+		name = name[:i]
+	}
+	return zerolog.NoLevel, false
+}
+
+// applyLevels must be called with levelsLock held whenever the global level or the overrides change.
+func applyLevels() {
+	lowest := zerolog.Level(globalLevel.Load())
+	if overrides := levelOverrides.Load(); overrides != nil {
+		for _, level := range overrides.levels {
+			if level < lowest {
+				lowest = level
+			}
+		}
+	}
+	minLevel.Store(int32(lowest))
+
+	// zerolog filters events below its own levels, so they are set to the most verbose level
+	// enabled anywhere and the logger decides what to drop.
+	zerolog.SetGlobalLevel(lowest)
+	updateRootLogger(func(root zerolog.Logger) zerolog.Logger {
+		return root.Level(lowest)
+	})
+}
+
+// mayBeEnabled is the fast path check, false means the level is disabled everywhere.
+func mayBeEnabled(level zerolog.Level) bool {
+	return level >= zerolog.Level(minLevel.Load())
+}
+
+// levelEnabled tells whether the level is enabled for this logger and its caller. It must be
+// called directly from logger.log, so that the caller is found at the same depth as the one
+// written to the log.
+func (l *logger) levelEnabled(level zerolog.Level) bool {
+	if !mayBeEnabled(level) {
+		return false
+	}
+	if levelOverrides.Load() == nil {
+		return level >= zerolog.Level(globalLevel.Load())
+	}
+	return level >= effectiveLevel(l.name, callerPackage(baseCallerSkipLevel+1+
+		int(l.additionalCallLevelSkips.Load())))
+}
+
+// effectiveLevel returns the level of the logger name and caller package: the override of the
+// name, otherwise the one of the package, otherwise the global level.
+func effectiveLevel(name string, pkg string) zerolog.Level {
+	if overrides := levelOverrides.Load(); overrides != nil {
+		if override, found := overrides.lookup(name); found && name != "" {
+			return override
+		}
+		if override, found := overrides.lookup(pkg); found {
+			return override
+		}
+	}
+	return zerolog.Level(globalLevel.Load())
+}
+
+// callerPackage returns the trimmed directory of the file of the caller, e.g. `pkg/middleware`.
+func callerPackage(skip int) string {
+	pc, file, _, ok := runtime.Caller(skip)
+	if !ok {
+		return ""
+	}
+	if pkg, found := callerPackages.Load(pc); found {
+		return pkg.(string)
+	}
+	pkg := path.Dir(trimCallerFile(file))
+	callerPackages.Store(pc, pkg)
+	return pkg
+}
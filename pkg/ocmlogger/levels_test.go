@@ -0,0 +1,120 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+// countingStringer counts how many times it was formatted.
+type countingStringer struct {
+	calls int
+}
+
+func (s *countingStringer) String() string {
+	s.calls++
+	return "formatted"
+}
+
+var _ = Describe("logger level overrides", Label("logger"), func() {
+	var (
+		ulog   OCMLogger
+		output ThreadSafeBytesBuffer
+	)
+
+	BeforeEach(func() {
+		ulog = NewOCMLogger(context.Background())
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		globalLevel := GetLogLevel()
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			Expect(SetLogLevelOverrides("")).To(Succeed())
+			Expect(SetLogLevel(globalLevel)).To(Succeed())
+		})
+		Expect(SetLogLevel("warn")).To(Succeed())
+	})
+
+	It("enables a more verbose level for the package of the caller", func() {
+		Expect(SetLogLevelOverrides("pkg/ocmlogger=debug")).To(Succeed())
+		ulog.Debug("legacy debug")
+		ulog.Contextual().Debug("contextual debug")
+		ulog.Trace("trace")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"message\":\"legacy debug\""))
+		Expect(result).To(ContainSubstring("\"message\":\"contextual debug\""))
+		Expect(result).NotTo(ContainSubstring("trace"))
+	})
+
+	It("disables levels for the package of the caller", func() {
+		Expect(SetLogLevelOverrides("pkg=error")).To(Succeed())
+		ulog.Warning("warning")
+		Expect(output.String()).To(Equal(""))
+	})
+
+	It("uses the most specific package", func() {
+		Expect(SetLogLevelOverrides("pkg=error, pkg/ocmlogger=info, pkg/ocmlogger/other=trace")).To(Succeed())
+		ulog.Info("info")
+		ulog.Debug("debug")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"message\":\"info\""))
+		Expect(result).NotTo(ContainSubstring("debug"))
+	})
+
+	It("keeps the global level for other packages", func() {
+		Expect(SetLogLevelOverrides("pkg/middleware=trace")).To(Succeed())
+		ulog.Info("info")
+		Expect(output.String()).To(Equal(""))
+	})
+
+	It("overrides named loggers before packages", func() {
+		Expect(SetLogLevelOverrides("pkg/ocmlogger=error,region-proxy=debug")).To(Succeed())
+		named := NewNamedOCMLogger(context.Background(), "region-proxy/cache")
+		named.Debug("named debug")
+		ulog.Warning("warning")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"message\":\"named debug\""))
+		Expect(result).To(ContainSubstring("\"logger\":\"region-proxy/cache\""))
+		Expect(result).NotTo(ContainSubstring("warning"))
+	})
+
+	It("falls back to the package of named loggers", func() {
+		Expect(SetLogLevelOverrides("pkg/ocmlogger=info")).To(Succeed())
+		NewNamedOCMLogger(context.Background(), "region-proxy").Info("info")
+		Expect(output.String()).To(ContainSubstring("\"message\":\"info\""))
+	})
+
+	It("doesn't format messages of disabled levels", func() {
+		stringer := &countingStringer{}
+		ulog.Debug("debug %v", stringer)
+		Expect(stringer.calls).To(Equal(0))
+
+		Expect(SetLogLevelOverrides("pkg/ocmlogger=debug")).To(Succeed())
+		ulog.Debug("debug %v", stringer)
+		Expect(stringer.calls).To(Equal(1))
+		Expect(output.String()).To(ContainSubstring("\"message\":\"debug formatted\""))
+	})
+
+	It("returns the overrides in a canonical form", func() {
+		Expect(SetLogLevelOverrides(" pkg/b=debug,/pkg/a/=TRACE,, ")).To(Succeed())
+		Expect(GetLogLevelOverrides()).To(Equal("pkg/a=trace,pkg/b=debug"))
+		Expect(GetLogLevel()).To(Equal("warn"))
+
+		Expect(SetLogLevelOverrides("")).To(Succeed())
+		Expect(GetLogLevelOverrides()).To(Equal(""))
+	})
+
+	It("rejects invalid overrides and keeps the current ones", func() {
+		Expect(SetLogLevelOverrides("pkg/a=debug")).To(Succeed())
+		Expect(SetLogLevelOverrides("pkg/b")).NotTo(Succeed())
+		Expect(SetLogLevelOverrides("=debug")).NotTo(Succeed())
+		Expect(SetLogLevelOverrides("pkg/b=loud")).NotTo(Succeed())
+		Expect(GetLogLevelOverrides()).To(Equal("pkg/a=debug"))
+	})
+})
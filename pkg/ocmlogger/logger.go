@@ -28,6 +28,7 @@ type OCMLogger interface {
 
 	AdditionalCallLevelSkips(skip int) OCMLogger
 	CaptureSentryEvent(capture bool) OCMLogger
+
 	Trace(args ...any)
 	Debug(args ...any)
 	Info(args ...any)
@@ -36,12 +37,38 @@ type OCMLogger interface {
 	Fatal(args ...any)
 }
 
-var _ OCMLogger = &logger{}
+// ScopedLogger is an OCMLogger that creates child loggers. The loggers of this package implement
+// it, the ones of unknown origin can be checked with a type assertion:
+//
+//	if scoped, ok := ulog.(ocmlogger.ScopedLogger); ok {
+//		ulog = scoped.WithValues("cluster_id", id)
+//	}
+type ScopedLogger interface {
+	OCMLogger
+
+	// WithValues returns a child logger adding the key/values to all its entries and sentry events.
+	// The logger itself is unchanged.
+	WithValues(keysAndValues ...interface{}) ScopedLogger
+
+	// WithName returns a child logger whose name is the name of the logger followed by `/` and name,
+	// see NewNamedOCMLogger. The logger itself is unchanged.
+	WithName(name string) ScopedLogger
+
+	// WithExtraDataRegistry returns a child logger also adding the values of the callbacks of the
+	// registry, after the ones of RegisterExtraDataCallback, e.g. for libraries that shouldn't
+	// register global callbacks. The logger itself is unchanged.
+	WithExtraDataRegistry(registry *ExtraDataRegistry) ScopedLogger
+}
 
-type extraCallbacks map[string]func(ctx context.Context) any
+var _ ScopedLogger = &logger{}
 
 type logger struct {
 	ctx                      context.Context
+	name                     string
+	values                   []interface{}
+	unsampled                bool
+	alwaysEnabled            bool // written whatever the levels, for audit entries
+	extraData                *ExtraDataRegistry
 	additionalCallLevelSkips atomic.Int32
 
 	captureSentrySet           atomic.Bool
@@ -63,28 +90,14 @@ var (
 	OCM_LOG_ERROR           = zerolog.ErrorLevel.String()
 	OCM_LOG_LEVEL_DEFAULT   = OCM_LOG_WARN
 
-	rootLogger zerolog.Logger // root logger used by our application
+	rootLogger     atomic.Pointer[zerolog.Logger] // root logger used by our application
+	rootLoggerLock sync.Mutex                     // serializes the updates of rootLogger
 
 	// log.Info("foo") -> OCMLogger.Info -> OCMLogger.log -> OCMLogger.createLogEvent -> log library ...
 	// If we don't provide a base offset of 3, it will appear as if all logs are coming from OCMLogger.createLogEvent
 	baseCallerSkipLevel = 3
 
 	trimList = []string{"pkg"}
-
-	// The context in go requires key to be `exactly the same` both when setting with context.WithValue and getting with context.Value
-	// It makes library being unable to fetch those keys by itself if they are not `string` (even if its underlying type is `string`
-	// For example:
-	//
-	// 		const OpIDKey OperationIDKey = "opID"
-	// 		opID := util.NewID()
-	// 		ctx = context.WithValue(ctx, OpIDKey, opID)
-	//
-	// 		opID, ok := ctx.Value(OpIDKey).(string) -- this will work
-	// 		opID, ok := ctx.Value("opID").(string) -- this will NOT work
-	//
-	// We allow you to register callback functions to safely retrieve values from the context. The values returned
-	// by those functions will be added to the log as `Extra` fields under the provided key.
-	retrieveExtraFromContextCallbacks = make(extraCallbacks)
 )
 
 var possibleLogLevels = []string{
@@ -113,7 +126,8 @@ var sentryLevelMapping = map[zerolog.Level]sentry.Level{
  * initialization so that we can rely on logs for debugging if necessary.
  */
 func init() {
-	rootLogger = log.Logger
+	initial := log.Logger
+	rootLogger.Store(&initial)
 	_ = SetLogLevel(OCM_LOG_LEVEL_DEFAULT)
 
 	// register a callback function, so we can update state when flags are parsed
@@ -123,19 +137,19 @@ func init() {
 		}
 		return SetLogLevel(s)
 	})
+	flag.Func(OCM_LOG_LEVEL_OVERRIDES_FLAG_NAME,
+		"Comma separated log levels of packages or named loggers, e.g. pkg/middleware=debug,pkg/client=trace",
+		SetLogLevelOverrides)
+	flag.Func(OCM_LOG_FORMAT_FLAG_NAME, "Log format, one of: auto, json, console. "+
+		"auto renders for the console when the log output (stderr) is a terminal, JSON otherwise", setOutputFormatName)
+	// the format may also be set in the environment, unknown formats are auto
+	format, _ := ParseOutputFormat(os.Getenv(OCM_LOG_FORMAT_ENV))
+	SetOutputFormat(format)
 
 	// CallerMarshalFunc allows customization of global caller marshaling, i.e. .Caller()
 	// Used to trim caller file paths, so they look a bit nicer
 	zerolog.CallerMarshalFunc = func(_ uintptr, file string, line int) string {
-		file = strings.ReplaceAll(file, "\\", "/")
-		for _, t := range trimList {
-			if i := strings.Index(file, t); i > -1 {
-				file = file[i:]
-				break
-			}
-		}
-
-		return file + ":" + strconv.Itoa(line)
+		return trimCallerFile(file) + ":" + strconv.Itoa(line)
 	}
 	zerolog.TimeFieldFormat = time.RFC3339Nano
 }
@@ -149,6 +163,16 @@ func NewOCMLogger(ctx context.Context) OCMLogger {
 	}
 }
 
+// NewNamedOCMLogger creates a logger whose level can be overridden by name with
+// SetLogLevelOverrides, independently of the package it is used from. The name is added to the
+// log entries as the `logger` field.
+func NewNamedOCMLogger(ctx context.Context, name string) OCMLogger {
+	return &logger{
+		ctx:  ctx,
+		name: strings.Trim(name, "/"),
+	}
+}
+
 // SetLogLevel - update logger state to a new level
 func SetLogLevel(level string) error {
 	l, err := zerolog.ParseLevel(level)
@@ -156,16 +180,20 @@ func SetLogLevel(level string) error {
 		return err
 	}
 
-	zerolog.SetGlobalLevel(l) // try to keep zerolog global logger in sync even though we dont use it
-	rootLogger = rootLogger.Level(l)
+	levelsLock.Lock()
+	defer levelsLock.Unlock()
+	globalLevel.Store(int32(l))
+	applyLevels()
 	return nil
 }
 
-// SetOutput - used for testing
+// SetOutput - used for testing, or with NewAsyncWriter in production
 // Whenever used, please be sure your io.Writer is threadsafe or you will end up with data races.
 // If you are testing, WrapUnsafeWriterWithLocks is an easy function to use to ensure this.
+// Outputs having a `Flush(ctx) error` method, like AsyncWriter, are flushed before Fatal exits.
 func SetOutput(output io.Writer) {
-	rootLogger = rootLogger.Output(output)
+	currentOutput.Store(&outputHolder{writer: output})
+	applyOutput()
 }
 
 type ThreadSafeBytesBuffer interface {
@@ -212,16 +240,20 @@ func (t *threadSafeWriter) String() string {
 
 var _ io.Writer = &threadSafeWriter{}
 
-func RegisterExtraDataCallback(key string, callback func(ctx context.Context) any) {
-	retrieveExtraFromContextCallbacks[key] = callback
-}
-
-func ClearExtraDataCallbacks() {
-	retrieveExtraFromContextCallbacks = make(extraCallbacks)
-}
-
 func SetTrimList(trims []string) {
 	trimList = trims
+	callerPackages.Clear()
+}
+
+// trimCallerFile cuts the beginning of the caller file path up to the first entry of the trim list
+func trimCallerFile(file string) string {
+	file = strings.ReplaceAll(file, "\\", "/")
+	for _, t := range trimList {
+		if i := strings.Index(file, t); i > -1 {
+			return file[i:]
+		}
+	}
+	return file
 }
 
 func TraceEnabled() bool {
@@ -261,34 +293,62 @@ func (l *logger) getCaptureSentryEvent() (captureSentry bool, overridden bool) {
 	return l.captureSentryEventOverride.Load(), l.captureSentrySet.Load()
 }
 
+// The legacy methods call log directly, so that the caller is found at the same depth as from the
+// contextual methods.
+
 func (l *logger) Info(args ...any) {
-	l.legacyLog(zerolog.InfoLevel, args)
+	if l.legacyEnabled(zerolog.InfoLevel) {
+		template, message := legacyMessage(args)
+		l.log(zerolog.InfoLevel, template, message, nil, nil)
+	}
 }
 
 func (l *logger) Debug(args ...any) {
-	l.legacyLog(zerolog.DebugLevel, args)
+	if l.legacyEnabled(zerolog.DebugLevel) {
+		template, message := legacyMessage(args)
+		l.log(zerolog.DebugLevel, template, message, nil, nil)
+	}
 }
 
 func (l *logger) Trace(args ...any) {
-	l.legacyLog(zerolog.TraceLevel, args)
+	if l.legacyEnabled(zerolog.TraceLevel) {
+		template, message := legacyMessage(args)
+		l.log(zerolog.TraceLevel, template, message, nil, nil)
+	}
 }
 
 func (l *logger) Warning(args ...any) {
-	l.legacyLog(zerolog.WarnLevel, args)
+	if l.legacyEnabled(zerolog.WarnLevel) {
+		template, message := legacyMessage(args)
+		l.log(zerolog.WarnLevel, template, message, nil, nil)
+	}
 }
 
 func (l *logger) Fatal(args ...any) {
-	l.legacyLog(zerolog.FatalLevel, args)
+	template, message := legacyMessage(args)
+	l.log(zerolog.FatalLevel, template, message, nil, nil)
 }
 
 func (l *logger) Error(args ...any) {
-	l.legacyLog(zerolog.ErrorLevel, args)
+	if l.legacyEnabled(zerolog.ErrorLevel) {
+		template, message := legacyMessage(args)
+		l.log(zerolog.ErrorLevel, template, message, nil, nil)
+	}
+}
+
+// legacyEnabled is false when the message can't be logged nor sent to sentry, so it isn't formatted.
+func (l *logger) legacyEnabled(level zerolog.Level) bool {
+	if captureSentry, overridden := l.getCaptureSentryEvent(); overridden && captureSentry {
+		return true
+	}
+	return level >= zerolog.ErrorLevel || mayBeEnabled(level) || l.alwaysEnabled || unfilteredContext(l.ctx)
 }
 
-func (l *logger) legacyLog(level zerolog.Level, args []any) {
+// legacyMessage formats the arguments of the legacy methods, the first one being the format. It
+// returns the format as the template of the message.
+func legacyMessage(args []any) (template string, message string) {
 	if len(args) == 0 {
-		l.log(level, "", nil, nil)
-		return
+		return "", ""
 	}
 
 	messageString, isString := args[0].(string)
@@ -297,15 +357,15 @@ func (l *logger) legacyLog(level zerolog.Level, args []any) {
 	}
 
 	if len(args) == 1 {
-		l.log(level, messageString, nil, nil)
-		return
+		return messageString, messageString
 	}
 
-	l.log(level, fmt.Sprintf(messageString, args[1:]...), nil, nil)
+	return messageString, fmt.Sprintf(messageString, args[1:]...)
 }
 
-// Note: use the various "Depth" logging functions, so we get the correct file/line number in the logs
-func (l *logger) log(level zerolog.Level, message string, err error, keysAndValues []interface{}) {
+// Note: use the various "Depth" logging functions, so we get the correct file/line number in the logs.
+// The template identifies the message whatever its arguments, to sample repetitive lines.
+func (l *logger) log(level zerolog.Level, template string, message string, err error, keysAndValues []interface{}) {
 	if message == "" && err != nil {
 		message = err.Error()
 	}
@@ -318,41 +378,89 @@ func (l *logger) log(level zerolog.Level, message string, err error, keysAndValu
 		captureSentry = captureSentryOverride
 	}
 
-	// make sure we have all the extras from the context before trying to capture the sentry event
-	keysAndValues = append(keysAndValues, extrasFromContext(l.ctx)...)
+	// disabled levels are still reported to sentry when requested, and fatal always exits
+	unfiltered := l.alwaysEnabled || unfilteredContext(l.ctx)
+	enabled := unfiltered || l.levelEnabled(level)
+	if !enabled && !captureSentry && level != zerolog.FatalLevel {
+		return
+	}
+
+	// make sure we have all the bound values and the extras from the context before trying to
+	// capture the sentry event
+	if len(l.values) > 0 {
+		keysAndValues = append(append(make([]interface{}, 0, len(l.values)+len(keysAndValues)), l.values...),
+			keysAndValues...)
+	}
+	keysAndValues = append(keysAndValues, l.extrasFromContext()...)
+
+	// nothing sensitive may be written nor sent to sentry
+	message, keysAndValues, err = redact(message, keysAndValues, err)
 
+	var fingerprint []string
 	if captureSentry {
-		sentryId := l.tryCaptureSentryEvent(level, message, err, keysAndValues)
+		fingerprint = sentryFingerprint(template, message, err)
+	}
+
+	if sampler := currentSampler.Load(); sampler != nil && !l.unsampled && !unfiltered {
+		// the summaries of the suppressed lines are written with the levels of their call site
+		key := templateKey{
+			level:    level,
+			template: template,
+			name:     l.name,
+			pkg:      callerPackage(baseCallerSkipLevel + int(l.additionalCallLevelSkips.Load())),
+		}
+		enabled = enabled && sampler.allowLine(key)
+		captureSentry = captureSentry && sampler.allowSentry(key, strings.Join(fingerprint, "/"))
+		if !enabled && !captureSentry && level != zerolog.FatalLevel {
+			return
+		}
+	}
+
+	l.recordSpanEvent(level, message, err)
+
+	if captureSentry {
+		sentryId := l.tryCaptureSentryEvent(level, message, fingerprint, err, keysAndValues)
 		if sentryId != nil {
 			keysAndValues = append(keysAndValues, "SentryEventID", sentryId)
 		}
+	} else if enabled {
+		l.addSentryBreadcrumb(level, message, err, keysAndValues)
 	}
 
-	event := l.createLogEvent(level, err, keysAndValues)
-	// once an zerolog event is created, it is imperative that we call .Msg on it so that the event will be returned to the pool.
-	// if we don't do this, we leak from the pool which continues to grow.
-	// After calling .Msg, it is imperative that we do not call any additional methods on event because the pool is reused
-	// and this can cause data races in the library.
-	// if we ever move off zerolog, this likely requires consideration.
-	event.Msg(message)
+	if enabled {
+		event := l.createLogEvent(level, err, keysAndValues)
+		// once an zerolog event is created, it is imperative that we call .Msg on it so that the event will be returned to the pool.
+		// if we don't do this, we leak from the pool which continues to grow.
+		// After calling .Msg, it is imperative that we do not call any additional methods on event because the pool is reused
+		// and this can cause data races in the library.
+		// if we ever move off zerolog, this likely requires consideration.
+		event.Msg(message)
+	}
 
 	if level == zerolog.FatalLevel {
+		flushOutput()
 		os.Exit(1)
 	}
 }
 
-func (l *logger) tryCaptureSentryEvent(level zerolog.Level, message string, err error, keysAndValues []interface{}) *sentry.EventID {
+func (l *logger) tryCaptureSentryEvent(level zerolog.Level, message string, fingerprint []string, err error,
+	keysAndValues []interface{}) *sentry.EventID {
 	event := sentry.NewEvent()
 	event.Level = sentryLevelMapping[level]
 	event.Message = message
-	event.Fingerprint = []string{getMD5Hash(event.Message)}
+	event.Fingerprint = fingerprint
 	event.Extra = contextToLegacyExtra(keysAndValues)
+	l.enrichSentryEvent(event, keysAndValues)
 
 	if err != nil || level == zerolog.ErrorLevel || level == zerolog.FatalLevel {
 		var sentryStack *sentry.Stacktrace
 		if err != nil {
 			// support errors that include a stacktrace, such as github.com/pkg/errors
-			sentryStack = sentry.ExtractStacktrace(err)
+			stackErr := err
+			if redacted, ok := err.(*redactedError); ok {
+				stackErr = redacted.cause
+			}
+			sentryStack = sentry.ExtractStacktrace(stackErr)
 		}
 		if sentryStack == nil {
 			sentryStack = sentry.NewStacktrace()
@@ -375,6 +483,8 @@ func (l *logger) tryCaptureSentryEvent(level zerolog.Level, message string, err
 		}
 	}
 
+	l.addSentryTraceContext(event)
+
 	sentryHub := sentry.GetHubFromContext(l.ctx)
 	if sentryHub == nil {
 		sentryHub = sentry.CurrentHub()
@@ -386,13 +496,12 @@ func (l *logger) tryCaptureSentryEvent(level zerolog.Level, message string, err
 	return sentryHub.CaptureEvent(event)
 }
 
-func extrasFromContext(ctx context.Context) []interface{} {
-	ret := []interface{}{}
-	for k, callback := range retrieveExtraFromContextCallbacks {
-		if callback != nil {
-			v := callback(ctx)
-			ret = append(ret, k, v)
-		}
+// extrasFromContext returns the values retrieved from the logger context by the callbacks of all
+// loggers, then by the ones of the logger registry.
+func (l *logger) extrasFromContext() []interface{} {
+	ret := defaultExtraDataRegistry.appendExtras([]interface{}{}, l.ctx)
+	if l.extraData != nil {
+		ret = l.extraData.appendExtras(ret, l.ctx)
 	}
 	return ret
 }
@@ -412,14 +521,7 @@ func contextToLegacyExtra(keysAndValues []interface{}) map[string]interface{} {
 	for i, curr := range keysAndValues {
 		isKey := i%2 == 0
 		if isKey {
-			var ok bool
-			currKey, ok = curr.(string)
-			switch {
-			case !ok:
-				currKey = fmt.Sprintf("(NOT_A_STRING[%d])", i)
-			case len(currKey) == 0:
-				currKey = fmt.Sprintf("(MISSING_KEY[%d])", i)
-			}
+			currKey = legacyKeyAt(keysAndValues, i)
 			continue
 		}
 
@@ -436,24 +538,59 @@ func contextToLegacyExtra(keysAndValues []interface{}) map[string]interface{} {
 	return ret
 }
 
+// updateRootLogger replaces the root logger with the one derived from it by update. The events
+// being created keep using the previous one.
+func updateRootLogger(update func(root zerolog.Logger) zerolog.Logger) {
+	rootLoggerLock.Lock()
+	defer rootLoggerLock.Unlock()
+	updated := update(*rootLogger.Load())
+	rootLogger.Store(&updated)
+}
+
 func (l *logger) createLogEvent(level zerolog.Level, err error, extraKeysAndValues []interface{}) *zerolog.Event {
-	event := rootLogger.WithLevel(level).
+	root := *rootLogger.Load()
+	if output := outputFromContext(l.ctx); output != nil {
+		root = root.Output(output)
+	}
+	var event *zerolog.Event
+	if l.alwaysEnabled || unfilteredContext(l.ctx) {
+		// zerolog drops the events below its levels, but not the ones without level
+		event = root.Log().Str(zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc(level))
+	} else {
+		event = root.WithLevel(level)
+	}
+	event = event.
 		Caller(baseCallerSkipLevel + int(l.additionalCallLevelSkips.Load())).
 		Err(err)
+	event = addErrorDetails(event, err)
 
-	if len(extraKeysAndValues) > 0 {
-		// this extra nesting is required for serialization equality with old serializations.
-		// TODO 1. choose new serialization and start producing it
-		// TODO 2. update all consuming code to handle a new serialization format
-		// TODO 3. remove this extra nesting
-		event = event.Fields([]interface{}{"Extra", contextToLegacyExtra(extraKeysAndValues)})
+	if l.name != "" {
+		event = event.Str(loggerNameFieldName, l.name)
 	}
+	event = l.addTraceFields(event)
+
+	return addExtraFields(event, extraKeysAndValues)
+}
 
+// addExtraFields adds the key/values to the event in the format of the log schema.
+func addExtraFields(event *zerolog.Event, extraKeysAndValues []interface{}) *zerolog.Event {
+	if len(extraKeysAndValues) == 0 {
+		return event
+	}
+	schema := GetLogSchema()
+	if schema == LogSchemaLegacy || schema == LogSchemaDual {
+		// this extra nesting is required for serialization equality with old serializations,
+		// it will be removed once all consuming code handles LogSchemaV2.
+		event = event.Fields([]interface{}{legacyExtraFieldName, contextToLegacyExtra(extraKeysAndValues)})
+	}
+	if schema == LogSchemaV2 || schema == LogSchemaDual {
+		event = addFlatFields(event, extraKeysAndValues)
+	}
 	return event
 }
 
 func logLevelEnabled(callLevel zerolog.Level) bool {
-	configLevel := rootLogger.GetLevel()
+	configLevel := zerolog.Level(globalLevel.Load())
 	return configLevel != zerolog.Disabled && configLevel != zerolog.NoLevel && configLevel <= callLevel
 }
 
@@ -466,3 +603,46 @@ func getMD5Hash(text string) string {
 func (l *logger) Contextual() ContextualLogger {
 	return &contextualWrapper{delegate: l}
 }
+
+func (l *logger) WithValues(keysAndValues ...interface{}) ScopedLogger {
+	return l.withValues(keysAndValues)
+}
+
+func (l *logger) WithName(name string) ScopedLogger {
+	return l.withName(name)
+}
+
+func (l *logger) WithExtraDataRegistry(registry *ExtraDataRegistry) ScopedLogger {
+	child := l.child(l.ctx)
+	child.extraData = registry
+	return child
+}
+
+func (l *logger) withValues(keysAndValues []interface{}) *logger {
+	child := l.child(l.ctx)
+	child.values = append(append(make([]interface{}, 0, len(l.values)+len(keysAndValues)), l.values...),
+		keysAndValues...)
+	return child
+}
+
+func (l *logger) withName(name string) *logger {
+	child := l.child(l.ctx)
+	child.name = strings.Trim(l.name+"/"+strings.Trim(name, "/"), "/")
+	return child
+}
+
+// child returns a copy of the logger using ctx.
+func (l *logger) child(ctx context.Context) *logger {
+	child := &logger{
+		ctx:       ctx,
+		name:      l.name,
+		values:    l.values,
+		unsampled: l.unsampled,
+		extraData: l.extraData,
+	}
+	child.additionalCallLevelSkips.Store(l.additionalCallLevelSkips.Load())
+	if captureSentry, overridden := l.getCaptureSentryEvent(); overridden {
+		child.CaptureSentryEvent(captureSentry)
+	}
+	return child
+}
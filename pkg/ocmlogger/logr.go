@@ -0,0 +1,93 @@
+package ocmlogger
+
+import (
+	"context"
+	"strings"
+
+	"github.com/go-logr/logr"
+	"github.com/rs/zerolog"
+)
+
+// logrSink is a logr.LogSink writing to ocmlogger, e.g. to give ocmlogger to controller-runtime.
+type logrSink struct {
+	ctx       context.Context
+	name      string
+	values    []interface{}
+	callDepth int
+}
+
+var _ logr.LogSink = &logrSink{}
+var _ logr.CallDepthLogSink = &logrSink{}
+
+// NewLogr returns a logr.Logger writing to ocmlogger. V(0) is logged at info level, V(1) at debug
+// level and higher verbosities at trace level. Errors are captured by sentry like the ones of the
+// other loggers, and names compose with `/` as the named loggers of NewNamedOCMLogger.
+func NewLogr(ctx context.Context) logr.Logger {
+	return logr.New(NewLogrSink(ctx))
+}
+
+// NewLogrSink returns the logr.LogSink behind NewLogr.
+func NewLogrSink(ctx context.Context) logr.LogSink {
+	return &logrSink{ctx: ctx}
+}
+
+func (s *logrSink) Init(info logr.RuntimeInfo) {
+	s.callDepth += info.CallDepth
+}
+
+func (s *logrSink) Enabled(level int) bool {
+	return mayBeEnabled(logrLevel(level))
+}
+
+func (s *logrSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	s.logger().log(logrLevel(level), msg, msg, nil, s.withValues(keysAndValues))
+}
+
+func (s *logrSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	s.logger().log(zerolog.ErrorLevel, msg, msg, err, s.withValues(keysAndValues))
+}
+
+func (s *logrSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	child := *s
+	child.values = s.withValues(keysAndValues)
+	return &child
+}
+
+func (s *logrSink) WithName(name string) logr.LogSink {
+	child := *s
+	child.name = strings.Trim(s.name+"/"+name, "/")
+	return &child
+}
+
+func (s *logrSink) WithCallDepth(depth int) logr.LogSink {
+	child := *s
+	child.callDepth += depth
+	return &child
+}
+
+func (s *logrSink) withValues(keysAndValues []interface{}) []interface{} {
+	if len(s.values) == 0 {
+		return keysAndValues
+	}
+	values := make([]interface{}, 0, len(s.values)+len(keysAndValues))
+	return append(append(values, s.values...), keysAndValues...)
+}
+
+// logger returns the logger of a single entry, skipping the frames of logr.
+func (s *logrSink) logger() *logger {
+	l := &logger{ctx: s.ctx, name: s.name}
+	l.additionalCallLevelSkips.Store(int32(s.callDepth))
+	return l
+}
+
+// logrLevel maps the logr verbosity to a level.
+func logrLevel(level int) zerolog.Level {
+	switch {
+	case level <= 0:
+		return zerolog.InfoLevel
+	case level == 1:
+		return zerolog.DebugLevel
+	default:
+		return zerolog.TraceLevel
+	}
+}
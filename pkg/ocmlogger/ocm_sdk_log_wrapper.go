@@ -4,6 +4,7 @@ import (
 	"context"
 
 	sdk "github.com/openshift-online/ocm-sdk-go"
+	"github.com/rs/zerolog"
 )
 
 /**
@@ -12,6 +13,9 @@ import (
 
 type OcmSdkLogWrapper struct{}
 
+// ocmSdkAdapter formats the calls of the ocm-sdk, which always gives their context.
+var ocmSdkAdapter = printfAdapter{skips: 1}
+
 var _ sdk.Logger = &OcmSdkLogWrapper{}
 
 func NewOcmSdkLogWrapper() *OcmSdkLogWrapper {
@@ -35,31 +39,21 @@ func (w *OcmSdkLogWrapper) ErrorEnabled() bool {
 }
 
 func (w *OcmSdkLogWrapper) Debug(ctx context.Context, format string, args ...interface{}) {
-	params := []interface{}{format}
-	params = append(params, args...)
-	NewOCMLogger(ctx).AdditionalCallLevelSkips(1).Debug(params...)
+	ocmSdkAdapter.printf(ctx, zerolog.DebugLevel, format, args)
 }
 
 func (w *OcmSdkLogWrapper) Info(ctx context.Context, format string, args ...interface{}) {
-	params := []interface{}{format}
-	params = append(params, args...)
-	NewOCMLogger(ctx).AdditionalCallLevelSkips(1).Info(params...)
+	ocmSdkAdapter.printf(ctx, zerolog.InfoLevel, format, args)
 }
 
 func (w *OcmSdkLogWrapper) Warn(ctx context.Context, format string, args ...interface{}) {
-	params := []interface{}{format}
-	params = append(params, args...)
-	NewOCMLogger(ctx).AdditionalCallLevelSkips(1).Warning(params...)
+	ocmSdkAdapter.printf(ctx, zerolog.WarnLevel, format, args)
 }
 
 func (w *OcmSdkLogWrapper) Error(ctx context.Context, format string, args ...interface{}) {
-	params := []interface{}{format}
-	params = append(params, args...)
-	NewOCMLogger(ctx).AdditionalCallLevelSkips(1).Error(params...)
+	ocmSdkAdapter.printf(ctx, zerolog.ErrorLevel, format, args)
 }
 
 func (w *OcmSdkLogWrapper) Fatal(ctx context.Context, format string, args ...interface{}) {
-	params := []interface{}{format}
-	params = append(params, args...)
-	NewOCMLogger(ctx).Fatal(params...)
+	ocmSdkAdapter.printf(ctx, zerolog.FatalLevel, format, args)
 }
@@ -0,0 +1,139 @@
+package ocmlogtest
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/onsi/gomega/format"
+	"github.com/onsi/gomega/types"
+)
+
+// HaveLogged succeeds when a *Recorder, or a []Event, holds an entry of the level with the message
+// and key/values. The message and the values may be gomega matchers, the other values are compared
+// with the values decoded from the entry, after a JSON round trip. The entries may have more
+// key/values than the expected ones.
+func HaveLogged(level string, message interface{}, keysAndValues ...interface{}) types.GomegaMatcher {
+	return &haveLoggedMatcher{level: level, message: message, keysAndValues: keysAndValues}
+}
+
+// HaveCapturedSentryEvent succeeds when a *Recorder, or a []*sentry.Event, holds a sentry event of
+// the level, e.g. "error", whose message matches. The message may be a gomega matcher.
+func HaveCapturedSentryEvent(level string, message interface{}) types.GomegaMatcher {
+	return &haveCapturedSentryEventMatcher{level: level, message: message}
+}
+
+type haveLoggedMatcher struct {
+	level         string
+	message       interface{}
+	keysAndValues []interface{}
+}
+
+func (m *haveLoggedMatcher) Match(actual interface{}) (bool, error) {
+	var events []Event
+	switch typed := actual.(type) {
+	case *Recorder:
+		events = typed.Events()
+	case []Event:
+		events = typed
+	default:
+		return false, fmt.Errorf("HaveLogged expects a *Recorder or a []Event, got\n%s", format.Object(actual, 1))
+	}
+	if len(m.keysAndValues)%2 != 0 {
+		return false, fmt.Errorf("HaveLogged expects key/value pairs, got %d values", len(m.keysAndValues))
+	}
+	for _, event := range events {
+		matched, err := m.matchEvent(event)
+		if err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func (m *haveLoggedMatcher) matchEvent(event Event) (bool, error) {
+	if event.Level != m.level {
+		return false, nil
+	}
+	if matched, err := matchValue(m.message, event.Message); err != nil || !matched {
+		return false, err
+	}
+	for i := 0; i < len(m.keysAndValues); i += 2 {
+		key := fmt.Sprint(m.keysAndValues[i])
+		value, found := event.Fields[key]
+		if !found {
+			return false, nil
+		}
+		if matched, err := matchValue(m.keysAndValues[i+1], value); err != nil || !matched {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func (m *haveLoggedMatcher) FailureMessage(actual interface{}) string {
+	return format.Message(actual, "to have logged", m.expected())
+}
+
+func (m *haveLoggedMatcher) NegatedFailureMessage(actual interface{}) string {
+	return format.Message(actual, "not to have logged", m.expected())
+}
+
+func (m *haveLoggedMatcher) expected() string {
+	return fmt.Sprintf("level %q, message %s and key/values %s",
+		m.level, format.Object(m.message, 0), format.Object(m.keysAndValues, 0))
+}
+
+type haveCapturedSentryEventMatcher struct {
+	level   string
+	message interface{}
+}
+
+func (m *haveCapturedSentryEventMatcher) Match(actual interface{}) (bool, error) {
+	var events []*sentry.Event
+	switch typed := actual.(type) {
+	case *Recorder:
+		events = typed.SentryEvents()
+	case []*sentry.Event:
+		events = typed
+	default:
+		return false, fmt.Errorf("HaveCapturedSentryEvent expects a *Recorder or a []*sentry.Event, got\n%s",
+			format.Object(actual, 1))
+	}
+	for _, event := range events {
+		if string(event.Level) != m.level {
+			continue
+		}
+		if matched, err := matchValue(m.message, event.Message); err != nil || matched {
+			return matched, err
+		}
+	}
+	return false, nil
+}
+
+func (m *haveCapturedSentryEventMatcher) FailureMessage(actual interface{}) string {
+	return format.Message(actual, "to have captured a sentry event of level "+m.level+" with message", m.message)
+}
+
+func (m *haveCapturedSentryEventMatcher) NegatedFailureMessage(actual interface{}) string {
+	return format.Message(actual, "not to have captured a sentry event of level "+m.level+" with message",
+		m.message)
+}
+
+// matchValue matches the actual value with the expected matcher, or compares it with the expected
+// value as it would be decoded from JSON.
+func matchValue(expected interface{}, actual interface{}) (bool, error) {
+	if matcher, ok := expected.(types.GomegaMatcher); ok {
+		return matcher.Match(actual)
+	}
+	encoded, err := json.Marshal(expected)
+	if err != nil {
+		return false, err
+	}
+	var decoded interface{}
+	if err := json.Unmarshal(encoded, &decoded); err != nil {
+		return false, err
+	}
+	return reflect.DeepEqual(decoded, actual), nil
+}
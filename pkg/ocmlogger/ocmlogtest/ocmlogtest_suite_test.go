@@ -0,0 +1,13 @@
+package ocmlogtest_test
+
+import (
+	"testing"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+func TestOcmlogtest(t *testing.T) {
+	RegisterFailHandler(Fail)
+	RunSpecs(t, "OCMLogTest Suite")
+}
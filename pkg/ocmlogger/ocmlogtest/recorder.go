@@ -0,0 +1,199 @@
+// Package ocmlogtest captures the entries and sentry events of ocmlogger, for tests.
+//
+// A Recorder decorates a context so that the loggers created from it write to the recorder rather
+// than to the global output, and capture their sentry events with a fake sentry hub. They write
+// all their entries, whatever the levels of ocmlogger and its sampling. Parallel tests using their
+// own recorder don't see each other's entries:
+//
+//	recorder := ocmlogtest.NewRecorder()
+//	ctx := recorder.Context(context.Background())
+//	ocmlogger.NewOCMLogger(ctx).Contextual().Info("cluster created", "cluster_id", "123")
+//	Expect(recorder).To(ocmlogtest.HaveLogged("info", "cluster created", "cluster_id", "123"))
+//
+// Loggers not created from the recorder context, e.g. with context.Background(), still write to
+// the global output, with the levels of ocmlogger.
+package ocmlogtest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/openshift-online/ocm-service-common/pkg/ocmlogger"
+)
+
+// standardFields are the fields written by ocmlogger itself, the others are key/values.
+var standardFields = map[string]bool{
+	"level":   true,
+	"message": true,
+	"error":   true,
+	"caller":  true,
+	"time":    true,
+	"logger":  true,
+	"Extra":   true,
+}
+
+// Event is an entry written by a logger.
+type Event struct {
+	Level   string
+	Message string
+	Error   string
+	Caller  string
+	Logger  string
+	Time    time.Time
+
+	// Fields holds the key/values of the entry, whatever the ocmlogger.LogSchema, and the other
+	// fields such as `trace_id` or `error_chain`. They are decoded from JSON, numbers are float64.
+	Fields map[string]interface{}
+
+	// Raw is the entry as written.
+	Raw string
+}
+
+// Recorder captures the entries and sentry events of the loggers using its context.
+type Recorder struct {
+	lock      sync.Mutex
+	events    []Event
+	errors    []error
+	transport *sentryTransport
+	hub       *sentry.Hub
+}
+
+// NewRecorder returns an empty recorder.
+func NewRecorder() *Recorder {
+	transport := &sentryTransport{}
+	client, err := sentry.NewClient(sentry.ClientOptions{
+		Dsn:       "http://ocmlogtest@example.com/1",
+		Transport: transport,
+		Integrations: func([]sentry.Integration) []sentry.Integration {
+			return []sentry.Integration{}
+		},
+	})
+	if err != nil {
+		// the options are constant, this can't happen
+		panic(err)
+	}
+	return &Recorder{
+		transport: transport,
+		hub:       sentry.NewHub(client, sentry.NewScope()),
+	}
+}
+
+// Context returns a context whose loggers write all their entries to the recorder and send their
+// sentry events to the recorder's fake hub.
+func (r *Recorder) Context(ctx context.Context) context.Context {
+	ctx = ocmlogger.NewContextWithoutFilters(ocmlogger.NewContextWithOutput(ctx, r))
+	return sentry.SetHubOnContext(ctx, r.hub)
+}
+
+// Write parses the entries written by the loggers, it is the output of the recorder context.
+func (r *Recorder) Write(p []byte) (int, error) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	for _, line := range bytes.Split(p, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		event, err := parseEvent(line)
+		if err != nil {
+			r.errors = append(r.errors, err)
+			continue
+		}
+		r.events = append(r.events, event)
+	}
+	return len(p), nil
+}
+
+// Events returns the entries written so far.
+func (r *Recorder) Events() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]Event{}, r.events...)
+}
+
+// ParseErrors returns the errors of the entries that couldn't be parsed, they should never happen.
+func (r *Recorder) ParseErrors() []error {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+	return append([]error{}, r.errors...)
+}
+
+// SentryEvents returns the sentry events captured so far.
+func (r *Recorder) SentryEvents() []*sentry.Event {
+	return r.transport.Events()
+}
+
+// Reset forgets the entries and sentry events captured so far.
+func (r *Recorder) Reset() {
+	r.lock.Lock()
+	r.events = nil
+	r.errors = nil
+	r.lock.Unlock()
+	r.transport.Flush(0)
+	r.hub.Scope().ClearBreadcrumbs()
+}
+
+func parseEvent(line []byte) (Event, error) {
+	raw := map[string]interface{}{}
+	if err := json.Unmarshal(line, &raw); err != nil {
+		return Event{}, err
+	}
+	event := Event{
+		Level:   stringField(raw, "level"),
+		Message: stringField(raw, "message"),
+		Error:   stringField(raw, "error"),
+		Caller:  stringField(raw, "caller"),
+		Logger:  stringField(raw, "logger"),
+		Fields:  map[string]interface{}{},
+		Raw:     string(line),
+	}
+	event.Time, _ = time.Parse(time.RFC3339Nano, stringField(raw, "time"))
+	for key, value := range raw {
+		if !standardFields[key] {
+			event.Fields[key] = value
+		}
+	}
+	if extra, ok := raw["Extra"].(map[string]interface{}); ok {
+		for key, value := range extra {
+			event.Fields[key] = value
+		}
+	}
+	return event, nil
+}
+
+func stringField(raw map[string]interface{}, key string) string {
+	value, _ := raw[key].(string)
+	return value
+}
+
+// sentryTransport keeps the sentry events instead of sending them.
+type sentryTransport struct {
+	lock   sync.Mutex
+	events []*sentry.Event
+}
+
+var _ sentry.Transport = &sentryTransport{}
+
+func (t *sentryTransport) Configure(sentry.ClientOptions) {}
+
+func (t *sentryTransport) SendEvent(event *sentry.Event) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.events = append(t.events, event)
+}
+
+func (t *sentryTransport) Flush(time.Duration) bool {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	t.events = nil
+	return true
+}
+
+func (t *sentryTransport) Events() []*sentry.Event {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return append([]*sentry.Event{}, t.events...)
+}
@@ -0,0 +1,105 @@
+package ocmlogtest_test
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+
+	"github.com/openshift-online/ocm-service-common/pkg/ocmlogger"
+	"github.com/openshift-online/ocm-service-common/pkg/ocmlogger/ocmlogtest"
+)
+
+var _ = Describe("Recorder", func() {
+	var (
+		recorder *ocmlogtest.Recorder
+		ctx      context.Context
+	)
+
+	BeforeEach(func() {
+		recorder = ocmlogtest.NewRecorder()
+		ctx = recorder.Context(context.Background())
+	})
+
+	It("parses the entries of the loggers of its context", func() {
+		ocmlogger.NewNamedOCMLogger(ctx, "clusters").Contextual().Warning("cluster created",
+			"cluster_id", "123", "nodes", 3)
+
+		events := recorder.Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Level).To(Equal("warn"))
+		Expect(events[0].Message).To(Equal("cluster created"))
+		Expect(events[0].Logger).To(Equal("clusters"))
+		Expect(events[0].Caller).To(ContainSubstring("recorder_test.go"))
+		Expect(events[0].Fields).To(Equal(map[string]interface{}{"cluster_id": "123", "nodes": 3.0}))
+		Expect(recorder.ParseErrors()).To(BeEmpty())
+	})
+
+	It("reads the key/values of every schema", func() {
+		ocmlogger.SetLogSchema(ocmlogger.LogSchemaV2)
+		DeferCleanup(ocmlogger.SetLogSchema, ocmlogger.LogSchemaLegacy)
+
+		ocmlogger.NewOCMLogger(ctx).Contextual().Info("started", "port", 8000)
+		Expect(recorder).To(ocmlogtest.HaveLogged("info", "started", "port", 8000))
+	})
+
+	It("records all the levels", func() {
+		ocmlogger.NewOCMLogger(ctx).Contextual().Trace("polling", "attempt", 1)
+		ocmlogger.NewOCMLogger(ctx).Trace("polling %d", 2)
+
+		Expect(ocmlogger.GetLogLevel()).To(Equal("warn"))
+		Expect(recorder).To(ocmlogtest.HaveLogged("trace", "polling", "attempt", 1))
+		Expect(recorder).To(ocmlogtest.HaveLogged("trace", "polling 2"))
+	})
+
+	It("matches entries with HaveLogged", func() {
+		log := ocmlogger.NewOCMLogger(ctx).CaptureSentryEvent(false)
+		log.Contextual().Info("request served", "code", 200, "path", "/api")
+		log.Contextual().Error(fmt.Errorf("boom"), "request failed", "code", 500)
+
+		Expect(recorder).To(ocmlogtest.HaveLogged("info", "request served"))
+		Expect(recorder).To(ocmlogtest.HaveLogged("info", "request served", "code", 200))
+		Expect(recorder).To(ocmlogtest.HaveLogged("error", HavePrefix("request"), "code", BeNumerically(">=", 500)))
+		Expect(recorder).NotTo(ocmlogtest.HaveLogged("info", "request served", "code", 500))
+		Expect(recorder).NotTo(ocmlogtest.HaveLogged("info", "request served", "missing", "key"))
+		Expect(recorder).NotTo(ocmlogtest.HaveLogged("warn", "request served"))
+		Expect(recorder.Events()).To(ocmlogtest.HaveLogged("error", "request failed"))
+	})
+
+	It("captures the sentry events", func() {
+		ocmlogger.NewOCMLogger(ctx).Contextual().Error(fmt.Errorf("boom"), "request failed")
+
+		Expect(recorder).To(ocmlogtest.HaveCapturedSentryEvent("error", "request failed"))
+		Expect(recorder).NotTo(ocmlogtest.HaveCapturedSentryEvent("fatal", "request failed"))
+		Expect(recorder.SentryEvents()).To(HaveLen(1))
+	})
+
+	It("forgets everything on reset", func() {
+		ocmlogger.NewOCMLogger(ctx).Error("request failed")
+		recorder.Reset()
+		Expect(recorder.Events()).To(BeEmpty())
+		Expect(recorder.SentryEvents()).To(BeEmpty())
+	})
+
+	It("isolates the recorders", func() {
+		var wait sync.WaitGroup
+		recorders := make([]*ocmlogtest.Recorder, 10)
+		for i := range recorders {
+			recorders[i] = ocmlogtest.NewRecorder()
+			wait.Add(1)
+			go func(i int) {
+				defer wait.Done()
+				ocmlogger.NewOCMLogger(recorders[i].Context(context.Background())).Warning("recorder %d", i)
+			}(i)
+		}
+		wait.Wait()
+
+		for i, other := range recorders {
+			Expect(other.Events()).To(HaveLen(1))
+			Expect(other).To(ocmlogtest.HaveLogged("warn", fmt.Sprintf("recorder %d", i)))
+		}
+		Expect(recorder.Events()).To(BeEmpty())
+	})
+})
@@ -0,0 +1,209 @@
+package ocmlogger
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// printfAdapter is the base of the adapters of third party logger interfaces using printf style
+// calls. It formats the calls like the legacy methods, uses the context of the call, or its own
+// one, and reports the callers of the third party logger methods.
+type printfAdapter struct {
+	ctx context.Context
+
+	// skips are the frames between the callers and printf, or print
+	skips int
+}
+
+// printf logs the format and its arguments, it must be called from the methods implementing the
+// third party interfaces.
+func (a printfAdapter) printf(ctx context.Context, level zerolog.Level, format string, args []interface{}) {
+	l := a.logger(ctx)
+	if l.legacyEnabled(level) {
+		// like the legacy methods, a format without arguments is written as is
+		template, message := legacyMessage(append([]interface{}{format}, args...))
+		l.log(level, template, message, nil, nil)
+	}
+}
+
+// print logs the arguments formatted like fmt.Sprint, it must be called from the methods
+// implementing the third party interfaces.
+func (a printfAdapter) print(ctx context.Context, level zerolog.Level, args []interface{}) {
+	l := a.logger(ctx)
+	if l.legacyEnabled(level) {
+		message := strings.TrimSuffix(fmt.Sprint(args...), "\n")
+		l.log(level, message, message, nil, nil)
+	}
+}
+
+// context returns the context of the adapter, for the calls of third party interfaces without one.
+func (a printfAdapter) context() context.Context {
+	if a.ctx == nil {
+		return context.Background()
+	}
+	return a.ctx
+}
+
+func (a printfAdapter) logger(ctx context.Context) *logger {
+	if ctx == nil {
+		// third party callers may not have a context
+		ctx = a.context()
+	}
+	l := &logger{ctx: ctx}
+	l.additionalCallLevelSkips.Store(int32(a.skips))
+	return l
+}
+
+// adapterLevel parses the level of an adapter, info when it is invalid.
+func adapterLevel(level string) zerolog.Level {
+	parsed, err := zerolog.ParseLevel(level)
+	if err != nil || parsed == zerolog.NoLevel {
+		return zerolog.InfoLevel
+	}
+	return parsed
+}
+
+// PrintfLogger writes the Printf calls at a single level, for the libraries accepting a logger like
+// `interface{ Printf(format string, args ...interface{}) }`, e.g. the HTTP clients of go-jira.
+type PrintfLogger struct {
+	adapter printfAdapter
+	level   zerolog.Level
+}
+
+// NewPrintfLogger returns a PrintfLogger writing at the level, info when it isn't valid, with ctx
+// for sentry, tracing and the extra data callbacks.
+func NewPrintfLogger(ctx context.Context, level string) *PrintfLogger {
+	return &PrintfLogger{
+		adapter: printfAdapter{ctx: ctx, skips: 1},
+		level:   adapterLevel(level),
+	}
+}
+
+func (p *PrintfLogger) Printf(format string, args ...interface{}) {
+	p.adapter.printf(p.adapter.context(), p.level, format, args)
+}
+
+func (p *PrintfLogger) Print(args ...interface{}) {
+	p.adapter.print(p.adapter.context(), p.level, args)
+}
+
+// stdLogWriter receives the entries of a standard library log.Logger.
+type stdLogWriter struct {
+	adapter printfAdapter
+	level   zerolog.Level
+}
+
+// stdLogSkips are the frames of the log.Logger methods before its writer, e.g. log.Logger.Printf
+// and log.Logger.output.
+const stdLogSkips = 3
+
+// NewStdLogger returns a standard library log.Logger writing to ocmlogger at the level, info when it
+// isn't valid, e.g. for http.Server.ErrorLog. Its Fatal and Panic methods still exit and panic
+// after logging at the level.
+func NewStdLogger(ctx context.Context, level string) *log.Logger {
+	return log.New(&stdLogWriter{
+		adapter: printfAdapter{ctx: ctx, skips: stdLogSkips},
+		level:   adapterLevel(level),
+	}, "", 0)
+}
+
+func (w *stdLogWriter) Write(p []byte) (int, error) {
+	w.adapter.print(w.adapter.context(), w.level, []interface{}{string(p)})
+	return len(p), nil
+}
+
+// GlogWrapper has the logging methods of github.com/golang/glog, so that code using glog can move
+// to ocmlogger by replacing the package with a GlogWrapper.
+type GlogWrapper struct {
+	adapter printfAdapter
+}
+
+// GlogVerbose is returned by GlogWrapper.V, like glog.Verbose.
+type GlogVerbose struct {
+	adapter printfAdapter
+	level   zerolog.Level
+}
+
+// NewGlogWrapper returns a GlogWrapper using ctx for sentry, tracing and the extra data callbacks.
+func NewGlogWrapper(ctx context.Context) *GlogWrapper {
+	return &GlogWrapper{adapter: printfAdapter{ctx: ctx, skips: 1}}
+}
+
+// V maps the glog verbosity to a level like NewLogr: 0 is info, 1 debug and higher verbosities trace.
+func (g *GlogWrapper) V(level int) GlogVerbose {
+	return GlogVerbose{adapter: g.adapter, level: logrLevel(level)}
+}
+
+func (g *GlogWrapper) Info(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.InfoLevel, args)
+}
+
+func (g *GlogWrapper) Infof(format string, args ...interface{}) {
+	g.adapter.printf(g.adapter.context(), zerolog.InfoLevel, format, args)
+}
+
+func (g *GlogWrapper) Infoln(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.InfoLevel, sprintlnArgs(args))
+}
+
+func (g *GlogWrapper) Warning(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.WarnLevel, args)
+}
+
+func (g *GlogWrapper) Warningf(format string, args ...interface{}) {
+	g.adapter.printf(g.adapter.context(), zerolog.WarnLevel, format, args)
+}
+
+func (g *GlogWrapper) Warningln(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.WarnLevel, sprintlnArgs(args))
+}
+
+func (g *GlogWrapper) Error(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.ErrorLevel, args)
+}
+
+func (g *GlogWrapper) Errorf(format string, args ...interface{}) {
+	g.adapter.printf(g.adapter.context(), zerolog.ErrorLevel, format, args)
+}
+
+func (g *GlogWrapper) Errorln(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.ErrorLevel, sprintlnArgs(args))
+}
+
+func (g *GlogWrapper) Fatal(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.FatalLevel, args)
+}
+
+func (g *GlogWrapper) Fatalf(format string, args ...interface{}) {
+	g.adapter.printf(g.adapter.context(), zerolog.FatalLevel, format, args)
+}
+
+func (g *GlogWrapper) Fatalln(args ...interface{}) {
+	g.adapter.print(g.adapter.context(), zerolog.FatalLevel, sprintlnArgs(args))
+}
+
+// Enabled tells whether the verbosity may be logged.
+func (v GlogVerbose) Enabled() bool {
+	return mayBeEnabled(v.level)
+}
+
+func (v GlogVerbose) Info(args ...interface{}) {
+	v.adapter.print(v.adapter.context(), v.level, args)
+}
+
+func (v GlogVerbose) Infof(format string, args ...interface{}) {
+	v.adapter.printf(v.adapter.context(), v.level, format, args)
+}
+
+func (v GlogVerbose) Infoln(args ...interface{}) {
+	v.adapter.print(v.adapter.context(), v.level, sprintlnArgs(args))
+}
+
+// sprintlnArgs formats the arguments like fmt.Sprintln, as a single argument of print.
+func sprintlnArgs(args []interface{}) []interface{} {
+	return []interface{}{fmt.Sprintln(args...)}
+}
@@ -0,0 +1,118 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+
+	"github.com/getsentry/sentry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("printf adapters", Label("logger"), func() {
+	var (
+		output          ThreadSafeBytesBuffer
+		sentryTransport *TransportMock
+		ctx             context.Context
+	)
+
+	const caller = "\"caller\":\"pkg/ocmlogger/printf_adapter_test.go:"
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		sentryTransport = &TransportMock{}
+		sentryClient, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "http://whatever@example.com/1337",
+			Transport: sentryTransport,
+			Integrations: func(i []sentry.Integration) []sentry.Integration {
+				return []sentry.Integration{}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ctx = sentry.SetHubOnContext(context.Background(), sentry.NewHub(sentryClient, sentry.NewScope()))
+		globalLevel := GetLogLevel()
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			Expect(SetLogLevel(globalLevel)).To(Succeed())
+		})
+		Expect(SetLogLevel("trace")).To(Succeed())
+	})
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(output.String()), "\n")
+	}
+
+	It("formats the segment calls with the context of the wrapper", func() {
+		wrapper := NewSegmentLogWrapperWithContext(ctx)
+		wrapper.Logf("sending %d messages to %s", 3, "segment")
+		wrapper.Errorf("failed sending %d messages", 3)
+
+		Expect(lines()).To(HaveLen(2))
+		Expect(lines()[0]).To(ContainSubstring("\"message\":\"sending 3 messages to segment\""))
+		Expect(lines()[0]).To(ContainSubstring(caller))
+		Expect(lines()[1]).To(ContainSubstring("\"message\":\"failed sending 3 messages\""))
+		Expect(sentryTransport.Events()).To(HaveLen(1))
+	})
+
+	It("formats the ocm-sdk calls", func() {
+		wrapper := NewOcmSdkLogWrapper()
+		wrapper.Info(ctx, "sending request %s %s", "GET", "/api")
+		wrapper.Debug(ctx, "no arguments 100%")
+		wrapper.Error(ctx, "request failed: %v", "timeout")
+
+		Expect(lines()).To(HaveLen(3))
+		Expect(lines()[0]).To(ContainSubstring("\"message\":\"sending request GET /api\""))
+		Expect(lines()[1]).To(ContainSubstring("\"message\":\"no arguments 100%\""))
+		for _, line := range lines() {
+			Expect(line).To(ContainSubstring(caller))
+		}
+		Expect(sentryTransport.Events()).To(HaveLen(1))
+	})
+
+	It("writes the Printf calls at a level", func() {
+		printf := NewPrintfLogger(ctx, "debug")
+		printf.Printf("retrying %s", "request")
+		printf.Print("done")
+
+		Expect(lines()).To(HaveLen(2))
+		Expect(lines()[0]).To(ContainSubstring("\"level\":\"debug\""))
+		Expect(lines()[0]).To(ContainSubstring("\"message\":\"retrying request\""))
+		Expect(lines()[1]).To(ContainSubstring("\"message\":\"done\""))
+		Expect(lines()[1]).To(ContainSubstring(caller))
+	})
+
+	It("writes the entries of standard library loggers", func() {
+		stdLogger := NewStdLogger(ctx, "warn")
+		stdLogger.Printf("http: TLS handshake error from %s", "1.2.3.4")
+		stdLogger.Println("closing")
+
+		Expect(lines()).To(HaveLen(2))
+		Expect(lines()[0]).To(ContainSubstring("\"level\":\"warn\""))
+		Expect(lines()[0]).To(ContainSubstring("\"message\":\"http: TLS handshake error from 1.2.3.4\""))
+		Expect(lines()[0]).To(ContainSubstring(caller))
+		Expect(lines()[1]).To(ContainSubstring("\"message\":\"closing\""))
+	})
+
+	It("has the methods of glog", func() {
+		glog := NewGlogWrapper(ctx)
+		glog.Infof("cluster %s", "123")
+		glog.Warningln("quota", "exceeded")
+		glog.V(1).Info("debug ", 1)
+		glog.V(2).Infof("trace %d", 2)
+
+		Expect(lines()).To(HaveLen(4))
+		Expect(lines()[0]).To(ContainSubstring("\"message\":\"cluster 123\""))
+		Expect(lines()[1]).To(ContainSubstring("\"level\":\"warn\""))
+		Expect(lines()[1]).To(ContainSubstring("\"message\":\"quota exceeded\""))
+		Expect(lines()[2]).To(ContainSubstring("\"level\":\"debug\""))
+		Expect(lines()[2]).To(ContainSubstring("\"message\":\"debug 1\""))
+		Expect(lines()[3]).To(ContainSubstring("\"level\":\"trace\""))
+		for _, line := range lines() {
+			Expect(line).To(ContainSubstring(caller))
+		}
+		Expect(glog.V(1).Enabled()).To(BeTrue())
+	})
+})
@@ -0,0 +1,353 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"unicode"
+)
+
+// RedactionMode selects how the sensitive values are replaced.
+type RedactionMode int
+
+const (
+	// RedactMask replaces sensitive values with RedactedMask.
+	RedactMask RedactionMode = iota
+
+	// RedactHash replaces sensitive values with a short hash of them, so that log entries about
+	// the same value can still be correlated.
+	RedactHash
+)
+
+// RedactedMask replaces the sensitive values in RedactMask mode.
+const RedactedMask = "[REDACTED]"
+
+var (
+	// JWTPattern matches JSON web tokens, like the OCM access and refresh tokens.
+	JWTPattern = regexp.MustCompile(`eyJ[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*`)
+
+	// EmailPattern matches email addresses.
+	EmailPattern = regexp.MustCompile(`[A-Za-z0-9._%+-]+@[A-Za-z0-9.-]+\.[A-Za-z]{2,}`)
+
+	// DefaultRedactedKeys are the key rules of DefaultRedactor.
+	DefaultRedactedKeys = []string{
+		"token", "password", "passwd", "secret", "authorization", "cookie", "api_key", "apikey",
+		"credential", "credentials", "private_key",
+	}
+
+	// jsonMemberPattern matches the members of JSON objects whose value is a string, possibly cut,
+	// or a scalar, in documents that can't be decoded, e.g. truncated ones.
+	jsonMemberPattern = regexp.MustCompile(`"((?:[^"\\]|\\.)*)"(\s*:\s*)("(?:[^"\\]|\\.)*"?|[^,{}\[\]\s"]+)`)
+
+	// currentRedactor holds the *Redactor applied to all the log entries, nil disables redaction.
+	currentRedactor atomic.Pointer[Redactor]
+)
+
+func init() {
+	SetRedactor(DefaultRedactor())
+}
+
+// Redactor replaces sensitive data with masks or hashes. Values are redacted entirely when their
+// key ends with one of the key rules, and in part where they match one of the value rules. Keys
+// and rules are compared by whole segments, split on `_`, `-`, `.` and camel case, ignoring case:
+// `token` matches `access_token`, `accessToken` and `X-Token`, but not `token_expiry`. A Redactor
+// is immutable and safe for concurrent use.
+type Redactor struct {
+	keys   [][]string
+	values []*regexp.Regexp
+	mode   RedactionMode
+}
+
+// RedactorOption configures the redactor created by NewRedactor.
+type RedactorOption func(*Redactor)
+
+// WithRedactedKeys adds key rules, e.g. `token` redacts the values of `access_token` and `Token`
+// and `api_key` the ones of `X-Api-Key`.
+func WithRedactedKeys(keys ...string) RedactorOption {
+	return func(r *Redactor) {
+		for _, key := range keys {
+			if segments := keySegments(key); len(segments) > 0 {
+				r.keys = append(r.keys, segments)
+			}
+		}
+	}
+}
+
+// WithRedactedValues adds value rules, the parts of string values matching them are redacted.
+func WithRedactedValues(patterns ...*regexp.Regexp) RedactorOption {
+	return func(r *Redactor) {
+		r.values = append(r.values, patterns...)
+	}
+}
+
+// WithRedactionMode sets how sensitive values are replaced, RedactMask by default.
+func WithRedactionMode(mode RedactionMode) RedactorOption {
+	return func(r *Redactor) {
+		r.mode = mode
+	}
+}
+
+// NewRedactor creates a redactor with the given rules.
+func NewRedactor(opts ...RedactorOption) *Redactor {
+	r := &Redactor{}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
+}
+
+// DefaultRedactor redacts the values of the DefaultRedactedKeys and the JWTs. It is used by all
+// loggers unless SetRedactor is called.
+func DefaultRedactor(opts ...RedactorOption) *Redactor {
+	return NewRedactor(append([]RedactorOption{
+		WithRedactedKeys(DefaultRedactedKeys...),
+		WithRedactedValues(JWTPattern),
+	}, opts...)...)
+}
+
+// SetRedactor - update the redactor applied to the messages, errors and key/values of all loggers
+// before they are written or sent to sentry. A nil redactor disables redaction.
+func SetRedactor(redactor *Redactor) {
+	currentRedactor.Store(redactor)
+}
+
+// GetRedactor returns the redactor applied to all loggers, nil when redaction is disabled.
+func GetRedactor() *Redactor {
+	return currentRedactor.Load()
+}
+
+// IsSensitiveKey tells whether the values of the key are redacted entirely.
+func (r *Redactor) IsSensitiveKey(key string) bool {
+	if r == nil {
+		return false
+	}
+	segments := keySegments(key)
+	for _, rule := range r.keys {
+		if len(rule) <= len(segments) && slices.Equal(segments[len(segments)-len(rule):], rule) {
+			return true
+		}
+	}
+	return false
+}
+
+// keySegments splits a key on `_`, `-`, `.` and the lower to upper case transitions, and returns
+// its lower case segments.
+func keySegments(key string) []string {
+	var segments []string
+	var segment strings.Builder
+	var previous rune
+	flush := func() {
+		if segment.Len() > 0 {
+			segments = append(segments, strings.ToLower(segment.String()))
+			segment.Reset()
+		}
+	}
+	for _, c := range key {
+		switch {
+		case c == '_' || c == '-' || c == '.':
+			flush()
+		case unicode.IsUpper(c) && (unicode.IsLower(previous) || unicode.IsDigit(previous)):
+			flush()
+			segment.WriteRune(c)
+		default:
+			segment.WriteRune(c)
+		}
+		previous = c
+	}
+	flush()
+	return segments
+}
+
+// RedactString redacts the parts of the text matching the value rules.
+func (r *Redactor) RedactString(text string) string {
+	if r == nil {
+		return text
+	}
+	for _, pattern := range r.values {
+		text = pattern.ReplaceAllStringFunc(text, r.replace)
+	}
+	return text
+}
+
+// RedactValue redacts the value of a key: entirely when the key is sensitive, otherwise the
+// strings it holds, including the ones nested in maps and slices as decoded from JSON.
+func (r *Redactor) RedactValue(key string, value interface{}) interface{} {
+	if r == nil || value == nil {
+		return value
+	}
+	if r.IsSensitiveKey(key) {
+		return r.replace(fmt.Sprint(value))
+	}
+	switch v := value.(type) {
+	case string:
+		return r.RedactString(v)
+	case []byte:
+		return r.RedactString(string(v))
+	case error:
+		if redacted := r.RedactString(v.Error()); redacted != v.Error() {
+			return redacted
+		}
+	case map[string]interface{}:
+		redacted := make(map[string]interface{}, len(v))
+		for nestedKey, nestedValue := range v {
+			redacted[nestedKey] = r.RedactValue(nestedKey, nestedValue)
+		}
+		return redacted
+	case []interface{}:
+		redacted := make([]interface{}, len(v))
+		for i, nestedValue := range v {
+			redacted[i] = r.RedactValue("", nestedValue)
+		}
+		return redacted
+	}
+	return value
+}
+
+// RedactKeysAndValues returns a copy of the key/values with their values redacted.
+func (r *Redactor) RedactKeysAndValues(keysAndValues []interface{}) []interface{} {
+	if r == nil || len(keysAndValues) == 0 {
+		return keysAndValues
+	}
+	redacted := make([]interface{}, len(keysAndValues))
+	copy(redacted, keysAndValues)
+	for i := 1; i < len(redacted); i += 2 {
+		key, _ := redacted[i-1].(string)
+		redacted[i] = r.RedactValue(key, redacted[i])
+	}
+	return redacted
+}
+
+// RedactJSON redacts a JSON document, the values of sensitive keys entirely and the other strings
+// with the value rules. Invalid documents are redacted as text.
+func (r *Redactor) RedactJSON(body []byte) []byte {
+	if r == nil {
+		return body
+	}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var document interface{}
+	if err := decoder.Decode(&document); err != nil || decoder.More() {
+		return []byte(r.RedactString(r.redactJSONMembers(string(body))))
+	}
+	redacted, err := json.Marshal(r.RedactValue("", document))
+	if err != nil {
+		return []byte(r.RedactString(string(body)))
+	}
+	return redacted
+}
+
+// redactJSONMembers redacts the values of the sensitive keys of JSON text that can't be decoded.
+func (r *Redactor) redactJSONMembers(text string) string {
+	return jsonMemberPattern.ReplaceAllStringFunc(text, func(member string) string {
+		parts := jsonMemberPattern.FindStringSubmatch(member)
+		if !r.IsSensitiveKey(parts[1]) {
+			return member
+		}
+		// cut strings stay cut, the other values become strings
+		value, closing := parts[3], `"`
+		if strings.HasPrefix(value, `"`) {
+			value = value[1:]
+			if trimmed, found := strings.CutSuffix(value, `"`); found {
+				value = trimmed
+			} else {
+				closing = ""
+			}
+		}
+		return `"` + parts[1] + `"` + parts[2] + `"` + r.replace(value) + closing
+	})
+}
+
+// RedactBody redacts a request or response body according to its content type: JSON documents
+// and forms by key and value, anything else as text.
+func (r *Redactor) RedactBody(contentType string, body []byte) []byte {
+	if r == nil || len(body) == 0 {
+		return body
+	}
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+	switch {
+	case mediaType == "application/json" || strings.HasSuffix(mediaType, "+json"):
+		return r.RedactJSON(body)
+	case mediaType == "application/x-www-form-urlencoded":
+		form, err := url.ParseQuery(string(body))
+		if err != nil {
+			break
+		}
+		return []byte(r.redactQuery(form).Encode())
+	case mediaType == "" && json.Valid(body):
+		return r.RedactJSON(body)
+	}
+	return []byte(r.RedactString(string(body)))
+}
+
+// RedactURL redacts the password and the query parameters of sensitive keys of the URL, and the
+// rest of it with the value rules.
+func (r *Redactor) RedactURL(u *url.URL) string {
+	if u == nil {
+		return ""
+	}
+	if r == nil {
+		return u.String()
+	}
+	redacted := *u
+	if password, hasPassword := u.User.Password(); hasPassword {
+		redacted.User = url.UserPassword(u.User.Username(), r.replace(password))
+	}
+	if u.RawQuery != "" {
+		redacted.RawQuery = r.redactQuery(u.Query()).Encode()
+	}
+	return r.RedactString(redacted.String())
+}
+
+func (r *Redactor) redactQuery(query url.Values) url.Values {
+	for key, values := range query {
+		for i, value := range values {
+			values[i], _ = r.RedactValue(key, value).(string)
+		}
+	}
+	return query
+}
+
+func (r *Redactor) replace(value string) string {
+	if r.mode == RedactHash {
+		sum := sha256.Sum256([]byte(value))
+		return "sha256:" + hex.EncodeToString(sum[:8])
+	}
+	return RedactedMask
+}
+
+// redactedError replaces an error whose message contained sensitive data, the original error is
+// still used to find its stack trace.
+type redactedError struct {
+	message string
+	cause   error
+}
+
+func (e *redactedError) Error() string {
+	return e.message
+}
+
+func (e *redactedError) Unwrap() error {
+	return e.cause
+}
+
+// redact applies the current redactor to everything a log entry is made of.
+func redact(message string, keysAndValues []interface{}, err error) (string, []interface{}, error) {
+	redactor := GetRedactor()
+	if redactor == nil {
+		return message, keysAndValues, err
+	}
+	if err != nil {
+		if redacted := redactor.RedactString(err.Error()); redacted != err.Error() {
+			err = &redactedError{message: redacted, cause: err}
+		}
+	}
+	return redactor.RedactString(message), redactor.RedactKeysAndValues(keysAndValues), err
+}
@@ -0,0 +1,259 @@
+package ocmlogger
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+const (
+	defaultSamplingInterval = time.Second
+	defaultSummaryInterval  = time.Minute
+
+	// samplingLoggerName is the name of the logger writing the summaries of the suppressed lines.
+	samplingLoggerName = "ocmlogger/sampling"
+)
+
+// SamplingConfig limits how many identical log lines and sentry events are emitted. Lines are
+// identical when they have the same level and message template, i.e. the format of the legacy
+// methods or the message of the contextual ones, whatever their arguments, and are logged by the
+// same named logger from the same package. Fatal lines are never sampled.
+type SamplingConfig struct {
+	// Interval is the period the First lines are counted in, one second by default.
+	Interval time.Duration
+
+	// First lines of each template are written in every Interval, zero disables line sampling.
+	First int
+
+	// Thereafter one in every Thereafter lines is written after the First ones, zero drops them all.
+	Thereafter int
+
+	// SentryRate is the number of sentry events per second allowed for each fingerprint, zero
+	// disables sentry rate limiting.
+	SentryRate float64
+
+	// SentryBurst is the number of sentry events allowed at once for each fingerprint, 1 at least.
+	SentryBurst int
+
+	// SummaryInterval is how often the "Suppressed N similar messages" lines are written, one minute
+	// by default.
+	SummaryInterval time.Duration
+}
+
+// sampler applies a SamplingConfig.
+type sampler struct {
+	config SamplingConfig
+	now    func() time.Time
+	stop   chan struct{}
+
+	// templates holds the *templateCounter of each templateKey
+	templates sync.Map
+	// buckets holds the *sentryBucket of each fingerprint
+	buckets sync.Map
+}
+
+// templateKey identifies the sampled lines. The name of the logger and the package of the call site
+// decide the level of their summary.
+type templateKey struct {
+	level    zerolog.Level
+	template string
+	name     string
+	pkg      string
+}
+
+// templateCounter and sentryBucket are marked deleted, with their lock held, when summarize removes
+// them from the sampler, so that the loggers that loaded them just before retry with new ones
+// instead of updating lost entries.
+type templateCounter struct {
+	lock             sync.Mutex
+	deleted          bool
+	windowStart      time.Time
+	count            int
+	suppressed       int
+	sentrySuppressed int
+}
+
+type sentryBucket struct {
+	lock     sync.Mutex
+	deleted  bool
+	tokens   float64
+	lastFill time.Time
+}
+
+var currentSampler atomic.Pointer[sampler]
+
+// SetSampling - update the sampling of the log lines and the rate limiting of the sentry events of
+// all loggers. A nil config disables both, which is the default. The lines suppressed with the
+// previous config are summarized before it is replaced.
+func SetSampling(config *SamplingConfig) {
+	var next *sampler
+	if config != nil {
+		next = newSampler(*config, time.Now)
+		go next.run()
+	}
+	if previous := currentSampler.Swap(next); previous != nil {
+		close(previous.stop)
+	}
+}
+
+func newSampler(config SamplingConfig, now func() time.Time) *sampler {
+	if config.Interval <= 0 {
+		config.Interval = defaultSamplingInterval
+	}
+	if config.SummaryInterval <= 0 {
+		config.SummaryInterval = defaultSummaryInterval
+	}
+	config.SentryBurst = max(config.SentryBurst, 1)
+	return &sampler{
+		config: config,
+		now:    now,
+		stop:   make(chan struct{}),
+	}
+}
+
+// run writes the summaries periodically until the sampler is replaced.
+func (s *sampler) run() {
+	ticker := time.NewTicker(s.config.SummaryInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stop:
+			s.summarize()
+			return
+		case <-ticker.C:
+			s.summarize()
+		}
+	}
+}
+
+// allowLine tells whether a line may be written, counting the suppressed ones.
+func (s *sampler) allowLine(key templateKey) bool {
+	if s == nil || s.config.First <= 0 || key.level == zerolog.FatalLevel {
+		return true
+	}
+	counter := s.lockedCounter(key)
+	defer counter.lock.Unlock()
+
+	now := s.now()
+	if now.Sub(counter.windowStart) >= s.config.Interval {
+		counter.windowStart = now
+		counter.count = 0
+	}
+	counter.count++
+	if counter.count <= s.config.First ||
+		(s.config.Thereafter > 0 && (counter.count-s.config.First)%s.config.Thereafter == 0) {
+		return true
+	}
+	counter.suppressed++
+	return false
+}
+
+// allowSentry tells whether an event with the fingerprint may be sent, using a token bucket per
+// fingerprint. Fatal events are never limited.
+func (s *sampler) allowSentry(key templateKey, fingerprint string) bool {
+	if s == nil || s.config.SentryRate <= 0 || key.level == zerolog.FatalLevel {
+		return true
+	}
+	bucket := s.lockedBucket(fingerprint)
+	now := s.now()
+	bucket.tokens = min(float64(s.config.SentryBurst),
+		bucket.tokens+now.Sub(bucket.lastFill).Seconds()*s.config.SentryRate)
+	bucket.lastFill = now
+	allowed := bucket.tokens >= 1
+	if allowed {
+		bucket.tokens--
+	}
+	bucket.lock.Unlock()
+
+	if !allowed {
+		counter := s.lockedCounter(key)
+		counter.sentrySuppressed++
+		counter.lock.Unlock()
+	}
+	return allowed
+}
+
+// lockedCounter returns the counter of the key with its lock held.
+func (s *sampler) lockedCounter(key templateKey) *templateCounter {
+	for {
+		value, found := s.templates.Load(key)
+		if !found {
+			value, _ = s.templates.LoadOrStore(key, &templateCounter{windowStart: s.now()})
+		}
+		counter := value.(*templateCounter)
+		counter.lock.Lock()
+		if !counter.deleted {
+			return counter
+		}
+		counter.lock.Unlock()
+	}
+}
+
+// lockedBucket returns the bucket of the fingerprint with its lock held.
+func (s *sampler) lockedBucket(fingerprint string) *sentryBucket {
+	for {
+		value, _ := s.buckets.LoadOrStore(fingerprint, &sentryBucket{
+			tokens:   float64(s.config.SentryBurst),
+			lastFill: s.now(),
+		})
+		bucket := value.(*sentryBucket)
+		bucket.lock.Lock()
+		if !bucket.deleted {
+			return bucket
+		}
+		bucket.lock.Unlock()
+	}
+}
+
+// summarize writes a line for each template that had suppressed lines or events since the last
+// summary, and forgets the idle templates and fingerprints.
+func (s *sampler) summarize() {
+	now := s.now()
+	s.templates.Range(func(key, value any) bool {
+		counter := value.(*templateCounter)
+		counter.lock.Lock()
+		suppressed, sentrySuppressed := counter.suppressed, counter.sentrySuppressed
+		counter.suppressed, counter.sentrySuppressed = 0, 0
+		if now.Sub(counter.windowStart) >= s.config.Interval && suppressed == 0 && sentrySuppressed == 0 {
+			counter.deleted = true
+			s.templates.CompareAndDelete(key, counter)
+		}
+		counter.lock.Unlock()
+
+		if suppressed > 0 || sentrySuppressed > 0 {
+			writeSamplingSummary(key.(templateKey), suppressed, sentrySuppressed)
+		}
+		return true
+	})
+	s.buckets.Range(func(key, value any) bool {
+		bucket := value.(*sentryBucket)
+		bucket.lock.Lock()
+		refill := now.Sub(bucket.lastFill).Seconds() * s.config.SentryRate
+		if bucket.tokens+refill >= float64(s.config.SentryBurst) {
+			bucket.deleted = true
+			s.buckets.CompareAndDelete(key, bucket)
+		}
+		bucket.lock.Unlock()
+		return true
+	})
+}
+
+// writeSamplingSummary writes the summary of the suppressed lines of the key, when its level is
+// enabled for their call site. It runs in the sampler goroutine, so it has no caller of its own.
+func writeSamplingSummary(key templateKey, suppressed, sentrySuppressed int) {
+	if key.level < effectiveLevel(key.name, key.pkg) {
+		return
+	}
+	message, keysAndValues, _ := redact(fmt.Sprintf("Suppressed %d similar messages", suppressed),
+		[]interface{}{
+			"template", key.template,
+			"suppressed", suppressed,
+			"sentry_suppressed", sentrySuppressed,
+		}, nil)
+	root := *rootLogger.Load()
+	event := root.WithLevel(key.level).Str(loggerNameFieldName, samplingLoggerName)
+	addExtraFields(event, keysAndValues).Msg(message)
+}
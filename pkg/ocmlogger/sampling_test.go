@@ -0,0 +1,181 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/getsentry/sentry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+var _ = Describe("logger sampling", Label("logger"), func() {
+	var (
+		output          ThreadSafeBytesBuffer
+		sentryTransport *TransportMock
+		ulog            OCMLogger
+		now             time.Time
+		testSampler     *sampler
+	)
+
+	lines := func() []string {
+		return strings.Split(strings.TrimSpace(output.String()), "\n")
+	}
+
+	useSampling := func(config SamplingConfig) {
+		testSampler = newSampler(config, func() time.Time { return now })
+		currentSampler.Store(testSampler)
+	}
+
+	BeforeEach(func() {
+		now = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		sentryTransport = &TransportMock{}
+		sentryClient, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "http://whatever@example.com/1337",
+			Transport: sentryTransport,
+			Integrations: func(i []sentry.Integration) []sentry.Integration {
+				return []sentry.Integration{}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ulog = NewOCMLogger(sentry.SetHubOnContext(context.Background(), sentry.NewHub(sentryClient, sentry.NewScope())))
+		DeferCleanup(func() {
+			currentSampler.Store(nil)
+			SetOutput(os.Stderr)
+		})
+	})
+
+	It("writes the first lines of each template and then one in M", func() {
+		useSampling(SamplingConfig{First: 2, Thereafter: 3})
+		for i := 0; i < 10; i++ {
+			ulog.Warning("cluster %d not found", i)
+		}
+		ulog.Contextual().Warning("other")
+
+		Expect(lines()).To(HaveLen(5))
+		Expect(output.String()).To(ContainSubstring("cluster 0 not found"))
+		Expect(output.String()).To(ContainSubstring("cluster 1 not found"))
+		Expect(output.String()).To(ContainSubstring("cluster 4 not found"))
+		Expect(output.String()).To(ContainSubstring("cluster 7 not found"))
+		Expect(output.String()).To(ContainSubstring("other"))
+	})
+
+	It("starts again every interval", func() {
+		useSampling(SamplingConfig{First: 1, Interval: time.Second})
+		ulog.Warning("first")
+		ulog.Warning("first")
+		now = now.Add(time.Second)
+		ulog.Warning("first")
+		Expect(lines()).To(HaveLen(2))
+	})
+
+	It("summarizes the suppressed lines", func() {
+		useSampling(SamplingConfig{First: 1})
+		for i := 0; i < 5; i++ {
+			ulog.Warning("cluster %d not found", i)
+		}
+		testSampler.summarize()
+
+		summary := lines()[1]
+		Expect(summary).To(ContainSubstring("\"message\":\"Suppressed 4 similar messages\""))
+		Expect(summary).To(ContainSubstring("\"template\":\"cluster %d not found\""))
+		Expect(summary).To(ContainSubstring("\"level\":\"warn\""))
+		Expect(summary).To(ContainSubstring("\"logger\":\"ocmlogger/sampling\""))
+
+		// nothing new to summarize
+		testSampler.summarize()
+		Expect(lines()).To(HaveLen(2))
+	})
+
+	It("summarizes with the levels of the call site and without caller", func() {
+		Expect(SetLogLevelOverrides("pkg/ocmlogger=debug")).To(Succeed())
+		DeferCleanup(SetLogLevelOverrides, "")
+		useSampling(SamplingConfig{First: 1})
+		for i := 0; i < 3; i++ {
+			ulog.Debug("cluster %d not found", i)
+		}
+		testSampler.summarize()
+
+		Expect(lines()).To(HaveLen(2))
+		summary := lines()[1]
+		Expect(summary).To(ContainSubstring("\"message\":\"Suppressed 2 similar messages\""))
+		Expect(summary).To(ContainSubstring("\"level\":\"debug\""))
+		Expect(summary).NotTo(ContainSubstring("\"caller\""))
+	})
+
+	It("doesn't lose the counts of the templates forgotten while logging", func() {
+		useSampling(SamplingConfig{First: 1, SentryRate: 1})
+		key := templateKey{level: zerolog.WarnLevel, template: "cluster %d not found"}
+		stale := testSampler.lockedCounter(key)
+		stale.lock.Unlock()
+		staleBucket := testSampler.lockedBucket("fingerprint")
+		staleBucket.lock.Unlock()
+
+		// the idle counter and the full bucket are forgotten, the loggers holding them get new ones
+		now = now.Add(time.Second)
+		testSampler.summarize()
+		Expect(stale.deleted).To(BeTrue())
+		Expect(staleBucket.deleted).To(BeTrue())
+		counter := testSampler.lockedCounter(key)
+		counter.lock.Unlock()
+		Expect(counter).NotTo(BeIdenticalTo(stale))
+		bucket := testSampler.lockedBucket("fingerprint")
+		bucket.lock.Unlock()
+		Expect(bucket).NotTo(BeIdenticalTo(staleBucket))
+
+		Expect(testSampler.allowSentry(key, "fingerprint")).To(BeTrue())
+		Expect(testSampler.allowSentry(key, "fingerprint")).To(BeFalse())
+		testSampler.summarize()
+		Expect(output.String()).To(ContainSubstring("\"sentry_suppressed\":1"))
+	})
+
+	It("rate limits the sentry events of each fingerprint", func() {
+		useSampling(SamplingConfig{SentryRate: 1, SentryBurst: 2})
+		for i := 0; i < 5; i++ {
+			ulog.Error("database unavailable")
+		}
+		ulog.Error("other error")
+		Expect(sentryTransport.Events()).To(HaveLen(3))
+		// lines aren't sampled
+		Expect(lines()).To(HaveLen(6))
+
+		now = now.Add(time.Second)
+		ulog.Error("database unavailable")
+		Expect(sentryTransport.Events()).To(HaveLen(4))
+
+		testSampler.summarize()
+		Expect(output.String()).To(ContainSubstring("\"sentry_suppressed\":3"))
+	})
+
+	It("doesn't sample the loggers of the contexts without filters", func() {
+		useSampling(SamplingConfig{First: 1})
+		unfiltered := NewOCMLogger(NewContextWithoutFilters(context.Background()))
+		for i := 0; i < 3; i++ {
+			unfiltered.Debug("cluster %d not found", i)
+		}
+		Expect(lines()).To(HaveLen(3))
+	})
+
+	It("summarizes periodically", func() {
+		SetSampling(&SamplingConfig{First: 1, SummaryInterval: 10 * time.Millisecond})
+		DeferCleanup(func() { SetSampling(nil) })
+		ulog.Warning("repeated")
+		ulog.Warning("repeated")
+		Eventually(output.String).Should(ContainSubstring("Suppressed 1 similar messages"))
+	})
+
+	It("does nothing by default", func() {
+		for i := 0; i < 100; i++ {
+			ulog.Contextual().Error(fmt.Errorf("failed"), "repeated")
+		}
+		Expect(lines()).To(HaveLen(100))
+		Expect(sentryTransport.Events()).To(HaveLen(100))
+	})
+})
@@ -0,0 +1,159 @@
+package ocmlogger
+
+import (
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/rs/zerolog"
+)
+
+// LogSchema selects how the contextual key/values of a log entry are serialized.
+type LogSchema int32
+
+const (
+	// LogSchemaLegacy nests all key/values under a single "Extra" object. It is the default, for
+	// serialization equality with the logs produced before schemas were introduced.
+	LogSchemaLegacy LogSchema = iota
+
+	// LogSchemaV2 writes every key/value as a top level typed field. Keys that collide with the
+	// fields written by the logger itself (level, time, caller, ...) are prefixed with
+	// reservedFieldPrefix, as many times as needed not to collide with the other keys either.
+	LogSchemaV2
+
+	// LogSchemaDual writes both the legacy "Extra" object and the top level fields, so that log
+	// consumers can move to LogSchemaV2 before the legacy nesting is removed.
+	LogSchemaDual
+)
+
+// reservedFieldPrefix is prepended to the keys that collide with reserved field names in LogSchemaV2.
+const reservedFieldPrefix = "kv_"
+
+// legacyExtraFieldName is the name of the object holding all key/values in LogSchemaLegacy.
+const legacyExtraFieldName = "Extra"
+
+// loggerNameFieldName is the field holding the name of named loggers.
+const loggerNameFieldName = "logger"
+
+var logSchemaNames = map[LogSchema]string{
+	LogSchemaLegacy: "legacy",
+	LogSchemaV2:     "v2",
+	LogSchemaDual:   "dual",
+}
+
+var currentLogSchema atomic.Int32
+
+func (s LogSchema) String() string {
+	if name, ok := logSchemaNames[s]; ok {
+		return name
+	}
+	return fmt.Sprintf("LogSchema(%d)", int32(s))
+}
+
+// ParseLogSchema converts "legacy", "v2" or "dual" to the corresponding LogSchema.
+func ParseLogSchema(name string) (LogSchema, error) {
+	for schema, schemaName := range logSchemaNames {
+		if strings.EqualFold(name, schemaName) {
+			return schema, nil
+		}
+	}
+	return LogSchemaLegacy, fmt.Errorf("unknown log schema '%s', one of: legacy, v2, dual", name)
+}
+
+// SetLogSchema - update the serialization of key/values for all loggers
+func SetLogSchema(schema LogSchema) {
+	currentLogSchema.Store(int32(schema))
+}
+
+// GetLogSchema returns the serialization of key/values currently in use.
+func GetLogSchema() LogSchema {
+	return LogSchema(currentLogSchema.Load())
+}
+
+// isReservedFieldName tells whether a key would collide with a field written by the logger itself.
+func isReservedFieldName(key string) bool {
+	switch key {
+	case zerolog.LevelFieldName, zerolog.TimestampFieldName, zerolog.CallerFieldName,
+		zerolog.MessageFieldName, zerolog.ErrorFieldName, zerolog.ErrorStackFieldName,
+		legacyExtraFieldName, loggerNameFieldName, traceIdFieldName, spanIdFieldName,
+		errorChainFieldName, errorCodeFieldName, errorTypeFieldName:
+		return true
+	}
+	return false
+}
+
+// addFlatFields writes the key/values to the event as top level typed fields. Like the legacy
+// "Extra" object, the last value of a repeated key wins, but keys keep the order in which they
+// first appeared.
+func addFlatFields(event *zerolog.Event, keysAndValues []interface{}) *zerolog.Event {
+	values := contextToLegacyExtra(keysAndValues)
+	seen := make(map[string]bool, len(values))
+	for i := 0; i < len(keysAndValues); i += 2 {
+		key := legacyKeyAt(keysAndValues, i)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+
+		field := key
+		for reserved := isReservedFieldName(field); reserved; _, reserved = values[field] {
+			field = reservedFieldPrefix + field
+		}
+		event = addTypedField(event, field, values[key])
+	}
+	return event
+}
+
+// legacyKeyAt returns the key at index i exactly as contextToLegacyExtra names it.
+func legacyKeyAt(keysAndValues []interface{}, i int) string {
+	key, ok := keysAndValues[i].(string)
+	switch {
+	case !ok:
+		return fmt.Sprintf("(NOT_A_STRING[%d])", i)
+	case len(key) == 0:
+		return fmt.Sprintf("(MISSING_KEY[%d])", i)
+	}
+	return key
+}
+
+func addTypedField(event *zerolog.Event, key string, value interface{}) *zerolog.Event {
+	switch v := value.(type) {
+	case string:
+		return event.Str(key, v)
+	case bool:
+		return event.Bool(key, v)
+	case int:
+		return event.Int(key, v)
+	case int8:
+		return event.Int8(key, v)
+	case int16:
+		return event.Int16(key, v)
+	case int32:
+		return event.Int32(key, v)
+	case int64:
+		return event.Int64(key, v)
+	case uint:
+		return event.Uint(key, v)
+	case uint8:
+		return event.Uint8(key, v)
+	case uint16:
+		return event.Uint16(key, v)
+	case uint32:
+		return event.Uint32(key, v)
+	case uint64:
+		return event.Uint64(key, v)
+	case float32:
+		return event.Float32(key, v)
+	case float64:
+		return event.Float64(key, v)
+	case time.Time:
+		return event.Time(key, v)
+	case time.Duration:
+		return event.Dur(key, v)
+	case error:
+		return event.AnErr(key, v)
+	default:
+		return event.Interface(key, v)
+	}
+}
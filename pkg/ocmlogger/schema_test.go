@@ -0,0 +1,98 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/rs/zerolog"
+)
+
+// callerRE matches the caller field, whose line number changes whenever this file does.
+var callerRE = regexp.MustCompile(`"caller":"[^"]*\.go:[0-9]+"`)
+
+var _ = Describe("Log schemas", Label("logger"), func() {
+	var output ThreadSafeBytesBuffer
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		previousTimestampFunc := zerolog.TimestampFunc
+		zerolog.TimestampFunc = func() time.Time {
+			return time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+		}
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			SetLogSchema(LogSchemaLegacy)
+			zerolog.TimestampFunc = previousTimestampFunc
+		})
+	})
+
+	logEverything := func() {
+		NewOCMLogger(context.Background()).CaptureSentryEvent(false).Contextual().Error(
+			errors.New("boom"),
+			"something happened",
+			"string", "value",
+			"int", 42,
+			"float", 1.5,
+			"bool", true,
+			"duration", 1500*time.Millisecond,
+			"timestamp", time.Date(2023, 12, 31, 0, 0, 0, 0, time.UTC),
+			"nested", map[string]any{"a": 1},
+			"cause", errors.New("root cause"),
+			"level", "shadowed",
+			"caller", "shadowed",
+			"dup", 1,
+			"dup", 2,
+			"missing",
+		)
+	}
+
+	DescribeTable("match the golden files",
+		func(schema LogSchema, golden string) {
+			SetLogSchema(schema)
+			logEverything()
+			result := callerRE.ReplaceAllString(output.String(), `"caller":"<caller>"`)
+
+			// set UPDATE_GOLDEN=true to regenerate the golden files after an intended change of the output
+			path := filepath.Join("testdata", golden)
+			if os.Getenv("UPDATE_GOLDEN") == "true" {
+				Expect(os.WriteFile(path, []byte(result), 0600)).To(Succeed())
+			}
+			expected, err := os.ReadFile(path)
+			Expect(err).NotTo(HaveOccurred())
+			Expect(result).To(Equal(string(expected)))
+		},
+		Entry("legacy", LogSchemaLegacy, "schema_legacy.golden"),
+		Entry("v2", LogSchemaV2, "schema_v2.golden"),
+		Entry("dual", LogSchemaDual, "schema_dual.golden"),
+	)
+
+	It("renames the reserved keys without colliding with the other keys", func() {
+		SetLogSchema(LogSchemaV2)
+		NewOCMLogger(context.Background()).CaptureSentryEvent(false).Contextual().Warning("collision",
+			"level", "reserved", "kv_level", "user", "kv_kv_level", "other user")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring(`"level":"warn"`))
+		Expect(result).To(ContainSubstring(`"kv_kv_kv_level":"reserved"`))
+		Expect(result).To(ContainSubstring(`"kv_level":"user"`))
+		Expect(result).To(ContainSubstring(`"kv_kv_level":"other user"`))
+	})
+
+	It("parses schema names", func() {
+		for _, schema := range []LogSchema{LogSchemaLegacy, LogSchemaV2, LogSchemaDual} {
+			parsed, err := ParseLogSchema(schema.String())
+			Expect(err).NotTo(HaveOccurred())
+			Expect(parsed).To(Equal(schema))
+		}
+		_, err := ParseLogSchema("v3")
+		Expect(err).To(HaveOccurred())
+	})
+})
@@ -0,0 +1,89 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"os"
+
+	"github.com/getsentry/sentry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+)
+
+var _ = Describe("scoped loggers", Label("logger"), func() {
+	var (
+		output          ThreadSafeBytesBuffer
+		sentryTransport *TransportMock
+		ctx             context.Context
+		ulog            ScopedLogger
+	)
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+		})
+		sentryTransport = &TransportMock{}
+		sentryClient, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "http://whatever@example.com/1337",
+			Transport: sentryTransport,
+			Integrations: func(i []sentry.Integration) []sentry.Integration {
+				return []sentry.Integration{}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ctx = sentry.SetHubOnContext(context.Background(), sentry.NewHub(sentryClient, sentry.NewScope()))
+		ulog = NewOCMLogger(ctx).(ScopedLogger)
+	})
+
+	It("adds the bound values to the entries and sentry events", func() {
+		child := ulog.WithValues("cluster_id", "123")
+		child.Warning("legacy")
+		child.Contextual().Error(nil, "contextual", "attempt", 2)
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"Extra\":{\"cluster_id\":\"123\"}"))
+		Expect(result).To(ContainSubstring("\"attempt\":2"))
+		Expect(sentryTransport.lastEvent).NotTo(BeNil())
+		Expect(sentryTransport.lastEvent.Extra).To(HaveKeyWithValue("cluster_id", "123"))
+		Expect(sentryTransport.lastEvent.Extra).To(HaveKeyWithValue("attempt", 2))
+	})
+
+	It("doesn't change the parent", func() {
+		parent := ulog.WithValues("cluster_id", "123")
+		parent.WithValues("subscription_id", "456").WithName("child")
+		parent.Warning("parent")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"cluster_id\":\"123\""))
+		Expect(result).NotTo(ContainSubstring("subscription_id"))
+		Expect(result).NotTo(ContainSubstring("\"logger\""))
+	})
+
+	It("lets the values of the calls win", func() {
+		ulog.Contextual().WithValues("cluster_id", "123").Warning("overridden", "cluster_id", "456")
+		Expect(output.String()).To(ContainSubstring("\"Extra\":{\"cluster_id\":\"456\"}"))
+	})
+
+	It("composes the names", func() {
+		ulog.WithName("region-proxy").WithName("/cache/").Contextual().WithName("lookup").Warning("named")
+		Expect(output.String()).To(ContainSubstring("\"logger\":\"region-proxy/cache/lookup\""))
+	})
+
+	It("keeps the sentry override of the parent", func() {
+		ulog.CaptureSentryEvent(false).(ScopedLogger).WithValues("cluster_id", "123").Error("not captured")
+		Expect(sentryTransport.lastEvent).To(BeNil())
+	})
+
+	It("stashes the logger in contexts", func() {
+		stashed := NewContextWithLogger(ctx, ulog.WithName("handler").WithValues("cluster_id", "123"))
+		FromContext(context.WithValue(stashed, "other", "value")).Warning("from context")
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"logger\":\"handler\""))
+		Expect(result).To(ContainSubstring("\"cluster_id\":\"123\""))
+
+		Expect(FromContext(context.Background())).NotTo(BeNil())
+	})
+})
@@ -3,6 +3,7 @@ package ocmlogger
 import (
 	"context"
 
+	"github.com/rs/zerolog"
 	segment "github.com/segmentio/analytics-go/v3"
 )
 
@@ -10,18 +11,26 @@ import (
  * SegmentLogWrapper is a wrapper around OCMLogger that implements the segment.Logger interface.
  */
 
-type SegmentLogWrapper struct{}
+type SegmentLogWrapper struct {
+	adapter printfAdapter
+}
 
 var _ segment.Logger = &SegmentLogWrapper{}
 
 func NewSegmentLogWrapper() *SegmentLogWrapper {
-	return &SegmentLogWrapper{}
+	return NewSegmentLogWrapperWithContext(context.Background())
+}
+
+// NewSegmentLogWrapperWithContext returns a SegmentLogWrapper using ctx for sentry, tracing and the
+// extra data callbacks, as segment doesn't give any context to its logger.
+func NewSegmentLogWrapperWithContext(ctx context.Context) *SegmentLogWrapper {
+	return &SegmentLogWrapper{adapter: printfAdapter{ctx: ctx, skips: 1}}
 }
 
 func (w *SegmentLogWrapper) Logf(format string, args ...interface{}) {
-	NewOCMLogger(context.Background()).AdditionalCallLevelSkips(1).Info(format, args)
+	w.adapter.printf(w.adapter.context(), zerolog.InfoLevel, format, args)
 }
 
 func (w *SegmentLogWrapper) Errorf(format string, args ...interface{}) {
-	NewOCMLogger(context.Background()).AdditionalCallLevelSkips(1).Error(format, args)
+	w.adapter.printf(w.adapter.context(), zerolog.ErrorLevel, format, args)
 }
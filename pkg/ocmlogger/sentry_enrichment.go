@@ -0,0 +1,259 @@
+package ocmlogger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/openshift-online/ocm-sdk-go/authentication"
+	"github.com/rs/zerolog"
+)
+
+// SentryFingerprint groups the sentry events into issues. The template is the format of the
+// legacy methods or the message of the contextual ones, err may be nil.
+type SentryFingerprint func(template string, message string, err error) []string
+
+// SentryUserFunc returns the user of the request the context belongs to, or nil.
+type SentryUserFunc func(ctx context.Context) *sentry.User
+
+// sentryOptions holds the enrichment of the sentry events, it is replaced on every change.
+type sentryOptions struct {
+	tagKeys         map[string]bool
+	user            SentryUserFunc
+	breadcrumbLevel zerolog.Level
+	fingerprint     SentryFingerprint
+}
+
+var (
+	currentSentryOptions atomic.Pointer[sentryOptions]
+	sentryOptionsLock    sync.Mutex
+)
+
+func init() {
+	currentSentryOptions.Store(&sentryOptions{
+		tagKeys:         map[string]bool{},
+		breadcrumbLevel: zerolog.Disabled,
+		fingerprint:     FingerprintByMessage,
+	})
+}
+
+// updateSentryOptions applies the update to a copy of the current options.
+func updateSentryOptions(update func(options *sentryOptions)) {
+	sentryOptionsLock.Lock()
+	defer sentryOptionsLock.Unlock()
+	options := *currentSentryOptions.Load()
+	update(&options)
+	currentSentryOptions.Store(&options)
+}
+
+// SetSentryTagKeys - the values of these keys, e.g. `org_id` or `cluster_id`, are sent as tags of
+// the sentry events, so that issues can be searched by them. They remain in the event extra data.
+func SetSentryTagKeys(keys ...string) {
+	tagKeys := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		tagKeys[key] = true
+	}
+	updateSentryOptions(func(options *sentryOptions) {
+		options.tagKeys = tagKeys
+	})
+}
+
+// SetSentryUserFunc - set how the user of the sentry events is found from the logger context.
+// No user is sent by default, SentryUserFromToken sends the one of the authentication token. The
+// values of the user go through the redactor of SetRedactor.
+func SetSentryUserFunc(user SentryUserFunc) {
+	updateSentryOptions(func(options *sentryOptions) {
+		options.user = user
+	})
+}
+
+// SetSentryBreadcrumbLevel - the logged entries of this level and above that aren't captured as
+// events are recorded as breadcrumbs of the sentry hub of the logger context, so that the events
+// captured later for the same request show them. An empty level disables breadcrumbs, the default.
+func SetSentryBreadcrumbLevel(level string) error {
+	breadcrumbLevel := zerolog.Disabled
+	if level != "" {
+		parsed, err := zerolog.ParseLevel(level)
+		if err != nil {
+			return err
+		}
+		breadcrumbLevel = parsed
+	}
+	updateSentryOptions(func(options *sentryOptions) {
+		options.breadcrumbLevel = breadcrumbLevel
+	})
+	return nil
+}
+
+// SetSentryFingerprint - set how sentry events are grouped into issues, FingerprintByMessage by
+// default. The sentry rate limiting of SetSampling uses the same fingerprint.
+func SetSentryFingerprint(fingerprint SentryFingerprint) {
+	if fingerprint == nil {
+		fingerprint = FingerprintByMessage
+	}
+	updateSentryOptions(func(options *sentryOptions) {
+		options.fingerprint = fingerprint
+	})
+}
+
+// FingerprintByMessage groups the events with the same message, including its interpolated values.
+func FingerprintByMessage(_ string, message string, _ error) []string {
+	return []string{getMD5Hash(message)}
+}
+
+// FingerprintByTemplate groups the events with the same message template, whatever the values
+// interpolated in the message.
+func FingerprintByTemplate(template string, message string, _ error) []string {
+	if template == "" {
+		template = message
+	}
+	return []string{getMD5Hash(template)}
+}
+
+// genericErrorWrappers are the types of errors that only add a message or a stack to the errors
+// they wrap, they are skipped by FingerprintByErrorType.
+var genericErrorWrappers = map[string]bool{
+	"*fmt.wrapError":           true,
+	"*fmt.wrapErrors":          true,
+	"*errors.withStack":        true,
+	"*errors.withMessage":      true,
+	"*ocmlogger.redactedError": true,
+}
+
+// FingerprintByErrorType groups the events with the same message template and type of error. The
+// type is the one of the first error of the chain that isn't a generic wrapper, like the ones of
+// fmt.Errorf or github.com/pkg/errors.
+func FingerprintByErrorType(template string, message string, err error) []string {
+	fingerprint := FingerprintByTemplate(template, message, err)
+	for err != nil {
+		errorType := fmt.Sprintf("%T", err)
+		cause := errors.Unwrap(err)
+		if !genericErrorWrappers[errorType] || cause == nil {
+			return append(fingerprint, errorType)
+		}
+		err = cause
+	}
+	return fingerprint
+}
+
+// SentryUserFromToken returns the user of the OCM authentication token of the context, as set by
+// the authentication handler of the ocm-sdk, or nil.
+func SentryUserFromToken(ctx context.Context) *sentry.User {
+	if ctx == nil {
+		return nil
+	}
+	token, err := authentication.TokenFromContext(ctx)
+	if err != nil || token == nil {
+		return nil
+	}
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return nil
+	}
+	user := &sentry.User{
+		ID:       firstClaim(claims, "user_id", "sub"),
+		Username: firstClaim(claims, "preferred_username", "username", "client_id", "clientId"),
+	}
+	if organization, ok := claims["organization"].(map[string]interface{}); ok {
+		if orgId, ok := organization["id"].(string); ok {
+			user.Data = map[string]string{"org_id": orgId}
+		}
+	} else if orgId := firstClaim(claims, "org_id"); orgId != "" {
+		user.Data = map[string]string{"org_id": orgId}
+	}
+	if user.ID == "" && user.Username == "" {
+		return nil
+	}
+	return user
+}
+
+// redactSentryUser passes the values of the user through the current redactor.
+func redactSentryUser(user sentry.User) sentry.User {
+	redactor := GetRedactor()
+	if redactor == nil {
+		return user
+	}
+	redact := func(key, value string) string {
+		if value == "" {
+			return value
+		}
+		return fmt.Sprint(redactor.RedactValue(key, value))
+	}
+	user.ID = redact("id", user.ID)
+	user.Email = redact("email", user.Email)
+	user.IPAddress = redact("ip_address", user.IPAddress)
+	user.Username = redact("username", user.Username)
+	user.Name = redact("name", user.Name)
+	if len(user.Data) > 0 {
+		data := make(map[string]string, len(user.Data))
+		for key, value := range user.Data {
+			data[key] = redact(key, value)
+		}
+		user.Data = data
+	}
+	return user
+}
+
+func firstClaim(claims jwt.MapClaims, names ...string) string {
+	for _, name := range names {
+		if value, ok := claims[name].(string); ok && value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// sentryFingerprint returns the fingerprint of an event with the current strategy.
+func sentryFingerprint(template string, message string, err error) []string {
+	return currentSentryOptions.Load().fingerprint(template, message, err)
+}
+
+// enrichSentryEvent adds the tags and the user to the event.
+func (l *logger) enrichSentryEvent(event *sentry.Event, keysAndValues []interface{}) {
+	options := currentSentryOptions.Load()
+	if len(options.tagKeys) > 0 {
+		for i := 0; i+1 < len(keysAndValues); i += 2 {
+			if key, ok := keysAndValues[i].(string); ok && options.tagKeys[key] {
+				if event.Tags == nil {
+					event.Tags = map[string]string{}
+				}
+				event.Tags[key] = fmt.Sprint(keysAndValues[i+1])
+			}
+		}
+	}
+	if options.user != nil {
+		if user := options.user(l.ctx); user != nil {
+			event.User = redactSentryUser(*user)
+		}
+	}
+}
+
+// addSentryBreadcrumb records a logged entry that isn't captured as an event on the sentry hub of
+// the logger context, when enabled with SetSentryBreadcrumbLevel.
+func (l *logger) addSentryBreadcrumb(level zerolog.Level, message string, err error, keysAndValues []interface{}) {
+	if level < currentSentryOptions.Load().breadcrumbLevel || l.ctx == nil {
+		return
+	}
+	hub := sentry.GetHubFromContext(l.ctx)
+	if hub == nil {
+		return
+	}
+	data := contextToLegacyExtra(keysAndValues)
+	if err != nil {
+		if data == nil {
+			data = map[string]interface{}{}
+		}
+		data[zerolog.ErrorFieldName] = err.Error()
+	}
+	hub.AddBreadcrumb(&sentry.Breadcrumb{
+		Type:     "default",
+		Category: "log",
+		Message:  message,
+		Level:    sentryLevelMapping[level],
+		Data:     data,
+	}, nil)
+}
@@ -0,0 +1,170 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/golang-jwt/jwt/v4"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/openshift-online/ocm-sdk-go/authentication"
+)
+
+var _ = Describe("Sentry enrichment", Label("logger"), func() {
+	var (
+		sentryTransport *TransportMock
+		hub             *sentry.Hub
+		ctx             context.Context
+	)
+
+	BeforeEach(func() {
+		SetOutput(WrapUnsafeWriterWithLocks(&bytes.Buffer{}))
+		sentryTransport = &TransportMock{}
+		sentryClient, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "http://whatever@example.com/1337",
+			Transport: sentryTransport,
+			Integrations: func(i []sentry.Integration) []sentry.Integration {
+				return []sentry.Integration{}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		hub = sentry.NewHub(sentryClient, sentry.NewScope())
+		ctx = sentry.SetHubOnContext(context.Background(), hub)
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			SetSentryTagKeys()
+			SetSentryUserFunc(nil)
+			SetSentryFingerprint(nil)
+			Expect(SetSentryBreadcrumbLevel("")).To(Succeed())
+		})
+	})
+
+	It("promotes the configured keys to tags", func() {
+		SetSentryTagKeys("org_id", "cluster_id")
+		NewOCMLogger(ctx).Contextual().Error(nil, "failed", "cluster_id", "123", "org_id", 456, "other", "x")
+
+		Expect(sentryTransport.lastEvent.Tags).To(Equal(map[string]string{"cluster_id": "123", "org_id": "456"}))
+		Expect(sentryTransport.lastEvent.Extra).To(HaveKeyWithValue("cluster_id", "123"))
+	})
+
+	It("doesn't send the user by default", func() {
+		ctx = authentication.ContextWithToken(ctx, &jwt.Token{Claims: jwt.MapClaims{
+			"user_id":            "42",
+			"preferred_username": "jdoe",
+		}})
+		NewOCMLogger(ctx).Error("failed")
+
+		Expect(sentryTransport.lastEvent.User).To(Equal(sentry.User{}))
+	})
+
+	It("sets the user from the authentication token", func() {
+		SetSentryUserFunc(SentryUserFromToken)
+		ctx = authentication.ContextWithToken(ctx, &jwt.Token{Claims: jwt.MapClaims{
+			"sub":                "f:abc",
+			"user_id":            "42",
+			"preferred_username": "jdoe",
+			"organization":       map[string]interface{}{"id": "org-1"},
+		}})
+		NewOCMLogger(ctx).Error("failed")
+
+		Expect(sentryTransport.lastEvent.User).To(Equal(sentry.User{
+			ID:       "42",
+			Username: "jdoe",
+			Data:     map[string]string{"org_id": "org-1"},
+		}))
+	})
+
+	It("redacts the user", func() {
+		redactor := GetRedactor()
+		SetRedactor(NewRedactor(WithRedactedKeys("username", "org_id")))
+		DeferCleanup(SetRedactor, redactor)
+		SetSentryUserFunc(func(ctx context.Context) *sentry.User {
+			return &sentry.User{ID: "42", Username: "jdoe", Data: map[string]string{"org_id": "org-1"}}
+		})
+		NewOCMLogger(ctx).Error("failed")
+
+		Expect(sentryTransport.lastEvent.User).To(Equal(sentry.User{
+			ID:       "42",
+			Username: RedactedMask,
+			Data:     map[string]string{"org_id": RedactedMask},
+		}))
+	})
+
+	It("uses a custom user function", func() {
+		SetSentryUserFunc(func(ctx context.Context) *sentry.User {
+			return &sentry.User{ID: "custom"}
+		})
+		NewOCMLogger(ctx).Error("failed")
+		Expect(sentryTransport.lastEvent.User.ID).To(Equal("custom"))
+
+		SetSentryUserFunc(nil)
+		NewOCMLogger(ctx).Error("failed")
+		Expect(sentryTransport.lastEvent.User).To(Equal(sentry.User{}))
+	})
+
+	It("records the lower level entries as breadcrumbs", func() {
+		Expect(SetSentryBreadcrumbLevel("warn")).To(Succeed())
+		ulog := NewOCMLogger(ctx)
+		ulog.Info("not logged")
+		ulog.Contextual().Warning("retrying", "attempt", 1)
+		ulog.Error("failed")
+
+		breadcrumbs := sentryTransport.lastEvent.Breadcrumbs
+		Expect(breadcrumbs).To(HaveLen(1))
+		Expect(breadcrumbs[0].Message).To(Equal("retrying"))
+		Expect(breadcrumbs[0].Level).To(Equal(sentry.LevelWarning))
+		Expect(breadcrumbs[0].Data).To(HaveKeyWithValue("attempt", 1))
+	})
+
+	It("records the errors of the entries without key/values as breadcrumbs", func() {
+		Expect(SetSentryBreadcrumbLevel("info")).To(Succeed())
+		ulog := NewOCMLogger(ctx)
+		ulog.Contextual().WarningWithError(fmt.Errorf("timeout"), "retrying")
+		ulog.Error("failed")
+
+		breadcrumbs := sentryTransport.lastEvent.Breadcrumbs
+		Expect(breadcrumbs).To(HaveLen(1))
+		Expect(breadcrumbs[0].Data).To(Equal(map[string]interface{}{"error": "timeout"}))
+	})
+
+	It("doesn't record breadcrumbs by default", func() {
+		ulog := NewOCMLogger(ctx)
+		ulog.Warning("retrying")
+		ulog.Error("failed")
+		Expect(sentryTransport.lastEvent.Breadcrumbs).To(BeEmpty())
+	})
+
+	It("groups the events by message by default", func() {
+		ulog := NewOCMLogger(ctx)
+		ulog.Error("cluster %s not found", "1")
+		ulog.Error("cluster %s not found", "2")
+		events := sentryTransport.Events()
+		Expect(events[0].Fingerprint).NotTo(Equal(events[1].Fingerprint))
+	})
+
+	It("groups the events by template", func() {
+		SetSentryFingerprint(FingerprintByTemplate)
+		ulog := NewOCMLogger(ctx)
+		ulog.Error("cluster %s not found", "1")
+		ulog.Error("cluster %s not found", "2")
+		events := sentryTransport.Events()
+		Expect(events[0].Fingerprint).To(Equal(events[1].Fingerprint))
+	})
+
+	It("groups the events by template and error type", func() {
+		SetSentryFingerprint(FingerprintByErrorType)
+		contextual := NewOCMLogger(ctx).Contextual()
+		contextual.Error(fmt.Errorf("reading: %w", &fs.PathError{Op: "open", Path: "a", Err: fs.ErrNotExist}), "failed")
+		contextual.Error(fmt.Errorf("reading: %w", &fs.PathError{Op: "open", Path: "b", Err: fs.ErrNotExist}), "failed")
+		contextual.Error(fmt.Errorf("timeout"), "failed")
+		events := sentryTransport.Events()
+		Expect(events[0].Fingerprint).To(Equal(events[1].Fingerprint))
+		Expect(events[0].Fingerprint).NotTo(Equal(events[2].Fingerprint))
+		Expect(events[0].Fingerprint).To(ContainElement("*fs.PathError"))
+		Expect(events[2].Fingerprint).To(ContainElement("*errors.errorString"))
+	})
+})
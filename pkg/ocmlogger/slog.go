@@ -0,0 +1,126 @@
+package ocmlogger
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+
+	"github.com/rs/zerolog"
+)
+
+// slogCallerSkips are the frames of slog between its callers and the handler, e.g.
+// slog.Logger.Info and slog.Logger.log.
+const slogCallerSkips = 2
+
+// slogHandler is a slog.Handler writing to ocmlogger.
+type slogHandler struct {
+	ctx    context.Context
+	values []interface{}
+	groups []string
+}
+
+var _ slog.Handler = &slogHandler{}
+
+// NewSlogHandler returns a slog.Handler writing to ocmlogger. The slog levels are mapped to the
+// closest ocmlogger level, below debug to trace. The attributes of groups are written with keys
+// prefixed by the group names, like `group.key`. The first attribute holding an error is logged as
+// the error of the entry, so that sentry captures it like for the other loggers. The context given
+// to the slog methods, when any, is used instead of ctx for sentry, tracing and the extra data
+// callbacks.
+func NewSlogHandler(ctx context.Context) slog.Handler {
+	return &slogHandler{ctx: ctx}
+}
+
+// NewSlogger returns a slog.Logger using NewSlogHandler.
+func NewSlogger(ctx context.Context) *slog.Logger {
+	return slog.New(NewSlogHandler(ctx))
+}
+
+func (h *slogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return mayBeEnabled(slogLevel(level))
+}
+
+func (h *slogHandler) Handle(ctx context.Context, record slog.Record) error {
+	keysAndValues := make([]interface{}, 0, len(h.values)+2*record.NumAttrs())
+	keysAndValues = append(keysAndValues, h.values...)
+	var err error
+	prefix := h.prefix()
+	record.Attrs(func(attr slog.Attr) bool {
+		if recordErr, isError := attr.Value.Resolve().Any().(error); isError && err == nil {
+			err = recordErr
+			return true
+		}
+		keysAndValues = appendSlogAttr(keysAndValues, prefix, attr)
+		return true
+	})
+
+	if ctx == nil || ctx == context.Background() {
+		ctx = h.ctx
+	}
+	l := &logger{ctx: ctx}
+	l.additionalCallLevelSkips.Store(slogCallerSkips)
+	l.log(slogLevel(record.Level), record.Message, record.Message, err, keysAndValues)
+	return nil
+}
+
+func (h *slogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	child := *h
+	child.values = append([]interface{}{}, h.values...)
+	prefix := h.prefix()
+	for _, attr := range attrs {
+		child.values = appendSlogAttr(child.values, prefix, attr)
+	}
+	return &child
+}
+
+func (h *slogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	child := *h
+	child.groups = append(append([]string{}, h.groups...), name)
+	return &child
+}
+
+func (h *slogHandler) prefix() string {
+	if len(h.groups) == 0 {
+		return ""
+	}
+	return strings.Join(h.groups, ".") + "."
+}
+
+// appendSlogAttr appends the attribute as key/values, flattening groups.
+func appendSlogAttr(keysAndValues []interface{}, prefix string, attr slog.Attr) []interface{} {
+	value := attr.Value.Resolve()
+	if value.Kind() == slog.KindGroup {
+		groupPrefix := prefix
+		// attributes of groups without key are inlined
+		if attr.Key != "" {
+			groupPrefix = prefix + attr.Key + "."
+		}
+		for _, groupAttr := range value.Group() {
+			keysAndValues = appendSlogAttr(keysAndValues, groupPrefix, groupAttr)
+		}
+		return keysAndValues
+	}
+	if attr.Key == "" && value.Any() == nil {
+		return keysAndValues
+	}
+	return append(keysAndValues, prefix+attr.Key, value.Any())
+}
+
+// slogLevel maps the slog level to the closest level.
+func slogLevel(level slog.Level) zerolog.Level {
+	switch {
+	case level < slog.LevelDebug:
+		return zerolog.TraceLevel
+	case level < slog.LevelInfo:
+		return zerolog.DebugLevel
+	case level < slog.LevelWarn:
+		return zerolog.InfoLevel
+	case level < slog.LevelError:
+		return zerolog.WarnLevel
+	default:
+		return zerolog.ErrorLevel
+	}
+}
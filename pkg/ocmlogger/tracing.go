@@ -0,0 +1,81 @@
+package ocmlogger
+
+import (
+	"sync/atomic"
+
+	"github.com/getsentry/sentry-go"
+	"github.com/rs/zerolog"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	traceIdFieldName = "trace_id"
+	spanIdFieldName  = "span_id"
+
+	// spanEventName is the name of the span events recording log entries.
+	spanEventName = "log"
+)
+
+var recordSpanEvents atomic.Bool
+
+// SetRecordSpanEvents - when enabled, error and fatal log entries are also recorded as events of
+// the OpenTelemetry span of the logger context, if it is recording. Disabled by default.
+func SetRecordSpanEvents(record bool) {
+	recordSpanEvents.Store(record)
+}
+
+// spanContext returns the OpenTelemetry span context of the logger context, it is invalid when the
+// context has no span.
+func (l *logger) spanContext() trace.SpanContext {
+	if l.ctx == nil {
+		return trace.SpanContext{}
+	}
+	return trace.SpanContextFromContext(l.ctx)
+}
+
+// addTraceFields writes the trace and span ids of the logger context, if any.
+func (l *logger) addTraceFields(event *zerolog.Event) *zerolog.Event {
+	spanContext := l.spanContext()
+	if !spanContext.IsValid() {
+		return event
+	}
+	return event.
+		Str(traceIdFieldName, spanContext.TraceID().String()).
+		Str(spanIdFieldName, spanContext.SpanID().String())
+}
+
+// addSentryTraceContext links the sentry event to the trace of the logger context, if any.
+func (l *logger) addSentryTraceContext(event *sentry.Event) {
+	spanContext := l.spanContext()
+	if !spanContext.IsValid() {
+		return
+	}
+	if event.Contexts == nil {
+		event.Contexts = map[string]sentry.Context{}
+	}
+	event.Contexts["trace"] = sentry.Context{
+		traceIdFieldName: spanContext.TraceID().String(),
+		spanIdFieldName:  spanContext.SpanID().String(),
+	}
+}
+
+// recordSpanEvent adds the log entry to the span of the logger context, when enabled with
+// SetRecordSpanEvents.
+func (l *logger) recordSpanEvent(level zerolog.Level, message string, err error) {
+	if level < zerolog.ErrorLevel || !recordSpanEvents.Load() || l.ctx == nil {
+		return
+	}
+	span := trace.SpanFromContext(l.ctx)
+	if !span.IsRecording() {
+		return
+	}
+	attributes := []attribute.KeyValue{
+		attribute.String("log.severity", level.String()),
+		attribute.String("log.message", message),
+	}
+	if err != nil {
+		attributes = append(attributes, attribute.String("exception.message", err.Error()))
+	}
+	span.AddEvent(spanEventName, trace.WithAttributes(attributes...))
+}
@@ -0,0 +1,89 @@
+package ocmlogger
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+
+	"github.com/getsentry/sentry-go"
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+var _ = Describe("logger tracing", Label("logger"), func() {
+	var (
+		output   ThreadSafeBytesBuffer
+		recorder *tracetest.SpanRecorder
+		provider *sdktrace.TracerProvider
+	)
+
+	BeforeEach(func() {
+		output = WrapUnsafeWriterWithLocks(&bytes.Buffer{})
+		SetOutput(output)
+		recorder = tracetest.NewSpanRecorder()
+		provider = sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder))
+		DeferCleanup(func() {
+			SetOutput(os.Stderr)
+			SetRecordSpanEvents(false)
+			Expect(provider.Shutdown(context.Background())).To(Succeed())
+		})
+	})
+
+	It("adds the trace and span ids of the context", func() {
+		ctx, span := provider.Tracer("test").Start(context.Background(), "operation")
+		NewOCMLogger(ctx).Warning("warning")
+		span.End()
+
+		result := output.String()
+		Expect(result).To(ContainSubstring("\"trace_id\":\"" + span.SpanContext().TraceID().String() + "\""))
+		Expect(result).To(ContainSubstring("\"span_id\":\"" + span.SpanContext().SpanID().String() + "\""))
+		Expect(recorder.Ended()[0].Events()).To(BeEmpty())
+	})
+
+	It("adds nothing without span", func() {
+		NewOCMLogger(context.Background()).Warning("warning")
+		Expect(output.String()).NotTo(ContainSubstring("trace_id"))
+	})
+
+	It("links the sentry events to the trace", func() {
+		sentryTransport := &TransportMock{}
+		sentryClient, err := sentry.NewClient(sentry.ClientOptions{
+			Dsn:       "http://whatever@example.com/1337",
+			Transport: sentryTransport,
+			Integrations: func(i []sentry.Integration) []sentry.Integration {
+				return []sentry.Integration{}
+			},
+		})
+		Expect(err).NotTo(HaveOccurred())
+		ctx := sentry.SetHubOnContext(context.Background(), sentry.NewHub(sentryClient, sentry.NewScope()))
+		ctx, span := provider.Tracer("test").Start(ctx, "operation")
+		defer span.End()
+
+		NewOCMLogger(ctx).Error("error")
+		Expect(sentryTransport.lastEvent).NotTo(BeNil())
+		Expect(sentryTransport.lastEvent.Contexts["trace"]).
+			To(HaveKeyWithValue("trace_id", span.SpanContext().TraceID().String()))
+	})
+
+	It("records error entries as span events when enabled", func() {
+		SetRecordSpanEvents(true)
+		ctx, span := provider.Tracer("test").Start(context.Background(), "operation")
+		ulog := NewOCMLogger(ctx).CaptureSentryEvent(false)
+		ulog.Warning("warning")
+		ulog.Contextual().Error(errors.New("connection refused"), "Failed to call AMS")
+		span.End()
+
+		events := recorder.Ended()[0].Events()
+		Expect(events).To(HaveLen(1))
+		Expect(events[0].Name).To(Equal("log"))
+		Expect(events[0].Attributes).To(ContainElements(
+			attribute.String("log.severity", "error"),
+			attribute.String("log.message", "Failed to call AMS"),
+			attribute.String("exception.message", "connection refused"),
+		))
+	})
+})